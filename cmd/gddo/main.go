@@ -21,17 +21,104 @@
 // the user agent that gddo will use for HTTP requests. The --request-timeout
 // flag configures the timeout for roundtripping an HTTP request.
 //
+// gddo detects the license files of each module it fetches. The
+// --require-license flag hides the documentation, source code and examples
+// of packages to which no recognized license applies, including packages
+// fetched before license files were stored until their licenses have been
+// detected.
+//
+// The --check-examples flag enables checking the examples of packages when
+// they are fetched. Examples which go/doc and go test ignore or misread,
+// such as examples named after missing symbols or with malformed output
+// comments, are reported as warnings on the documentation page.
+//
 // gddo supports rendering documentation for multiple platforms. To
 // configure the default platform, specify the --platform flag.
 //
+// The --playground flag configures the Go playground used to share
+// examples, which may be a self-hosted instance. The --playground-view flag
+// sets a template for the URL of shared examples, in which "{id}" is
+// replaced with the snippet ID. Specify an empty --playground flag to
+// disable sharing, for example in air-gapped deployments. To run examples
+// on gddo itself, specify a sandbox command with the --run-command flag,
+// such as "go run ." or a container runtime invocation that mounts "{dir}".
+// The command runs without the environment of gddo, apart from PATH, GOROOT
+// and the Go proxy settings. The --run-timeout flag limits how long an
+// example may run, and the --run-concurrency flag how many examples run at
+// the same time. On Linux, the --run-memory and --run-processes flags limit
+// the memory of each process of the command and the number of processes
+// of its user, using prlimit(1) from util-linux, which must be installed;
+// a container runtime must enforce its own limits. When an example times
+// out, the command and the processes it started are killed. The Go
+// build and module caches used by the command are kept in the directory
+// given by the --run-cache-dir flag.
+//
+// gddo caches rendered documentation pages in memory. The --cache-size
+// flag sets the size of the cache in megabytes, and the --cache-ttl flag
+// how long pages are cached. Pages of a module are removed from the cache
+// when the module is fetched again. The --cache-dir flag configures a
+// directory in which pages are also cached, which may be shared by several
+// gddo processes on the same host. Pages cached in memory are only served
+// while the directory holds the same version of them, so that pages
+// replaced or removed by another process are not served.
+//
 // gddo can run behind a TLS-terminating reverse proxy. In order to ensure
-// that badge URIs use the correct scheme, have the reverse proxy set the
-// X-Forwarded-Proto HTTP header to the desired protocol (e.g. https).
+// that badge and feed URIs use the correct scheme, have the reverse proxy
+// set the X-Forwarded-Proto HTTP header to the desired protocol (e.g.
+// https).
+//
+// Requests which make gddo fetch modules or run examples are rate limited
+// per client: the --fetch-rate and --fetch-burst flags limit fetches of
+// packages which are not in the database and runs of examples, and the
+// --refresh-rate and --refresh-burst flags submissions of the refresh form.
+// Clients exceeding a limit receive a 429 Too Many Requests response. Behind a reverse proxy, list its addresses
+// with the --trusted-proxies flag, so that clients are identified by the
+// X-Forwarded-For header it sets. Fetches are only limited by default when
+// trusted proxies are listed, since the clients of an unlisted reverse
+// proxy would share its limit.
+//
+// Documentation pages carry Etag, Last-Modified and Cache-Control headers,
+// so that gddo can be fronted by a caching proxy or CDN. Source files of
+// versions named in the URL are marked as immutable. Other pages of versions
+// named in the URL may be cached for an hour, as they show the latest
+// version, retractions and deprecations, and pages of the latest version
+// for ten minutes.
+//
+// The --webhooks flag names a file of webhook subscriptions, one per line,
+// each consisting of a module path prefix (or "*" for all modules), a URL
+// and a secret separated by white space. When a module is refreshed and a
+// new latest version, a deprecation or a retraction is detected, matching
+// subscribers receive a JSON POST request signed with an HMAC-SHA256 of the
+// body in the X-Gddo-Signature header. Failed deliveries are retried with
+// exponential backoff.
+//
+// gddo logs structured messages to standard error, in the logfmt-style text
+// format or, with --log-format=json, as JSON objects. The --log-level flag
+// sets the minimum level of logged messages; at the debug level, every
+// request is logged. Messages about a request carry its ID, which is taken
+// from the X-Request-ID header if a reverse proxy sets it and is returned
+// in the X-Request-ID response header. Messages about a module fetch carry
+// a fetch ID along with the module path, version and platform, and the
+// request ID of the request which started it.
+//
+// The --hook-secret flag enables the /-/hooks/refresh endpoint, which
+// forges can call when tags are pushed, so that new versions are fetched
+// immediately. GitHub and Gitea push, create and release events and
+// sourcehut repo:post-update events are supported, as well as generic JSON
+// payloads of the form {"module_path": "example.org/m", "version":
+// "v1.2.3"}. Requests are authenticated with an HMAC-SHA256 signature of
+// the payload keyed with the secret, or with the secret as a bearer token.
+// Modules are identified by the URL of the repository, matching the paths
+// of known modules regardless of case. The "module" query parameter sets the
+// module path of the repository root if it otherwise differs from the
+// repository URL, such as for vanity import paths or the first fetch of a
+// module whose path differs in case.
 package main
 
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -46,16 +133,23 @@ func main() {
 	if err := flags.Parse(os.Args[1:]); err != nil {
 		log.Fatal(err)
 	}
+	logger, err := server.NewLogger(os.Stderr, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
 
 	srv, err := server.New(cfg)
 	if err != nil {
-		log.Fatalf("error creating server: %v", err)
+		slog.Error("error creating server", "error", err)
+		os.Exit(1)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
 		if err := serveHTTP(ctx, srv, cfg); err != nil {
-			log.Fatal(err)
+			slog.Error("error serving HTTP", "error", err)
+			os.Exit(1)
 		}
 	}()
 	// Refresh modules in the background
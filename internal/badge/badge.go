@@ -0,0 +1,101 @@
+// Package badge renders status badges in the flat style of shields.io.
+package badge
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+)
+
+// Badge colors.
+const (
+	Blue      = "#5272b4"
+	Green     = "#4c1"
+	Orange    = "#fe7d37"
+	Red       = "#e05d44"
+	LightGrey = "#9f9f9f"
+)
+
+const (
+	height  = 20
+	padding = 5 // horizontal padding around text
+)
+
+// A Badge is a status badge with a label on the left and a message on the
+// right.
+type Badge struct {
+	Label   string
+	Message string
+	Color   string // background color of the message
+}
+
+// SVG renders the badge as an SVG image.
+func (b Badge) SVG() []byte {
+	lw := textWidth(b.Label) + 2*padding
+	mw := textWidth(b.Message) + 2*padding
+	w := lw + mw
+	label := html.EscapeString(b.Label)
+	message := html.EscapeString(b.Message)
+	color := html.EscapeString(b.Color)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" role="img" aria-label="%s: %s">`,
+		w, height, label, message)
+	fmt.Fprintf(&buf, `<title>%s: %s</title>`, label, message)
+	buf.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&buf, `<clipPath id="r"><rect width="%d" height="%d" rx="3" fill="#fff"/></clipPath>`, w, height)
+	fmt.Fprintf(&buf, `<g clip-path="url(#r)"><rect width="%d" height="%d" fill="#555"/><rect x="%d" width="%d" height="%d" fill="%s"/><rect width="%d" height="%d" fill="url(#s)"/></g>`,
+		lw, height, lw, mw, height, color, w, height)
+	buf.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" text-rendering="geometricPrecision" font-size="11">`)
+	writeText(&buf, label, lw/2, lw-2*padding)
+	writeText(&buf, message, lw+mw/2, mw-2*padding)
+	buf.WriteString(`</g></svg>`)
+	return buf.Bytes()
+}
+
+// writeText writes escaped text centered at x with a shadow.
+func writeText(buf *bytes.Buffer, text string, x, width int) {
+	fmt.Fprintf(buf, `<text x="%d" y="15" fill="#010101" fill-opacity=".3" textLength="%d" lengthAdjust="spacing">%s</text>`,
+		x, width, text)
+	fmt.Fprintf(buf, `<text x="%d" y="14" textLength="%d" lengthAdjust="spacing">%s</text>`,
+		x, width, text)
+}
+
+// textWidth estimates the width in pixels of the text in 11px Verdana.
+func textWidth(s string) int {
+	var w float64
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return int(math.Ceil(w))
+}
+
+// runeWidth returns the approximate advance width of r in 11px Verdana.
+func runeWidth(r rune) float64 {
+	switch {
+	case r == 'i' || r == 'l' || r == 'j' || r == '|' || r == '\'':
+		return 3.1
+	case r == 'f' || r == 't' || r == 'r' || r == 'I':
+		return 4.4
+	case r == ' ' || r == '.' || r == ',' || r == ':' || r == ';':
+		return 3.9
+	case r == '-' || r == '(' || r == ')' || r == '/' || r == '[' || r == ']':
+		return 4.8
+	case r == 'm':
+		return 10.7
+	case r == 'w' || r == 'M':
+		return 9.5
+	case r == 'W':
+		return 10.9
+	case r == '+' || r == '=' || r == '~':
+		return 9.2
+	case r >= '0' && r <= '9':
+		return 7
+	case r >= 'a' && r <= 'z':
+		return 6.8
+	case r >= 'A' && r <= 'Z':
+		return 7.6
+	}
+	return 8
+}
@@ -0,0 +1,57 @@
+package badge
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSVG(t *testing.T) {
+	b := Badge{Label: "version", Message: "v1.2.3 <rc>", Color: Blue}
+	svg := b.SVG()
+
+	// The badge must be well-formed XML with escaped text
+	dec := xml.NewDecoder(strings.NewReader(string(svg)))
+	var texts []string
+	var width string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("SVG is not well-formed: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local == "svg" {
+				for _, a := range tok.Attr {
+					if a.Name.Local == "width" {
+						width = a.Value
+					}
+				}
+			}
+		case xml.CharData:
+			if s := strings.TrimSpace(string(tok)); s != "" {
+				texts = append(texts, s)
+			}
+		}
+	}
+	want := []string{"version: v1.2.3 <rc>", "version", "version", "v1.2.3 <rc>", "v1.2.3 <rc>"}
+	if strings.Join(texts, "|") != strings.Join(want, "|") {
+		t.Errorf("SVG texts = %q, want %q", texts, want)
+	}
+	if width == "" || width == "0" {
+		t.Errorf("SVG width = %q", width)
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	if w := textWidth(""); w != 0 {
+		t.Errorf("textWidth(\"\") = %d, want 0", w)
+	}
+	if narrow, wide := textWidth("iiii"), textWidth("mmmm"); narrow >= wide {
+		t.Errorf("textWidth(iiii) = %d >= textWidth(mmmm) = %d", narrow, wide)
+	}
+}
@@ -0,0 +1,231 @@
+// Package cache implements a cache of rendered documentation pages.
+package cache
+
+import (
+	"container/list"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/proxy"
+	"git.sr.ht/~sircmpwn/gddo/internal/stdlib"
+)
+
+// A Key identifies a rendered page.
+type Key struct {
+	Platform   string
+	ImportPath string
+	Version    string
+	View       string
+}
+
+// A Page is a rendered page.
+type Page struct {
+	Header  http.Header
+	Body    []byte
+	Created time.Time
+}
+
+// A Store is a second-level cache of rendered pages, which may be shared by
+// several servers.
+type Store interface {
+	// Get returns the page stored for the key, or nil if there is none.
+	Get(key Key) (*Page, error)
+	// Put stores the page for the key.
+	Put(key Key, page *Page) error
+	// ModTime returns the time the page for the key was last stored, or
+	// the zero time if there is none.
+	ModTime(key Key) (time.Time, error)
+	// Invalidate removes the pages of the packages in the module.
+	Invalidate(modulePath string) error
+}
+
+// Cache is an in-memory LRU cache of rendered pages, optionally backed by a
+// Store. A nil *Cache caches nothing. It is safe for concurrent use.
+//
+// As the store may be shared with other servers, which may replace or
+// invalidate its pages, a page cached in memory is only used while the
+// store holds the same version of it.
+type Cache struct {
+	maxSize int64
+	ttl     time.Duration
+	store   Store
+
+	mu      sync.Mutex
+	size    int64
+	gen     uint64
+	lru     *list.List // of *entry, most recently used first
+	entries map[Key]*list.Element
+}
+
+type entry struct {
+	key    Key
+	page   *Page
+	stored time.Time // modification time of the page in the store
+}
+
+// New returns a cache which holds up to maxSize bytes of pages in memory,
+// each for at most ttl. If ttl is zero, pages do not expire. If store is not
+// nil, pages are also stored in and retrieved from the store.
+func New(maxSize int64, ttl time.Duration, store Store) *Cache {
+	return &Cache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		store:   store,
+		lru:     list.New(),
+		entries: make(map[Key]*list.Element),
+	}
+}
+
+// Generation returns the number of invalidations of the cache. A page
+// rendered from data loaded before an invalidation may be stale, so callers
+// obtain the generation before loading the data of a page and pass it to
+// [Cache.Put].
+func (c *Cache) Generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// Get returns the page cached for the key, or nil if there is none.
+func (c *Cache) Get(key Key) *Page {
+	if c == nil {
+		return nil
+	}
+	var stored time.Time
+	if c.store != nil {
+		var err error
+		stored, err = c.store.ModTime(key)
+		if err != nil {
+			slog.Error("error reading cached page", "import_path", key.ImportPath,
+				"version", key.Version, "error", err)
+			return nil
+		}
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		ent := e.Value.(*entry)
+		if !c.expired(ent.page) && ent.stored.Equal(stored) {
+			c.lru.MoveToFront(e)
+			c.mu.Unlock()
+			return ent.page
+		}
+		c.remove(e)
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	if c.store == nil || stored.IsZero() {
+		return nil
+	}
+	page, err := c.store.Get(key)
+	if err != nil {
+		slog.Error("error reading cached page", "import_path", key.ImportPath,
+			"version", key.Version, "error", err)
+		return nil
+	}
+	if page == nil || c.expired(page) {
+		return nil
+	}
+	c.mu.Lock()
+	if c.gen == gen {
+		c.add(key, page, stored)
+	}
+	c.mu.Unlock()
+	return page
+}
+
+// Put caches the page for the key, unless the cache was invalidated since
+// the generation gen.
+func (c *Cache) Put(key Key, page *Page, gen uint64) {
+	if c == nil {
+		return
+	}
+	if c.Generation() != gen {
+		return
+	}
+	var stored time.Time
+	if c.store != nil {
+		err := c.store.Put(key, page)
+		if err == nil {
+			stored, err = c.store.ModTime(key)
+		}
+		if err != nil {
+			slog.Error("error caching page", "import_path", key.ImportPath,
+				"version", key.Version, "error", err)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	if c.gen == gen {
+		c.add(key, page, stored)
+	}
+	c.mu.Unlock()
+}
+
+// Invalidate removes the cached pages of the packages in the module.
+func (c *Cache) Invalidate(modulePath string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.gen++
+	for key, e := range c.entries {
+		if InModule(key.ImportPath, modulePath) {
+			c.remove(e)
+		}
+	}
+	c.mu.Unlock()
+
+	if c.store != nil {
+		if err := c.store.Invalidate(modulePath); err != nil {
+			slog.Error("error invalidating cached pages", "module", modulePath, "error", err)
+		}
+	}
+}
+
+// InModule reports whether the package importPath may belong to the module.
+// Packages of nested modules are included.
+func InModule(importPath, modulePath string) bool {
+	if modulePath == proxy.StdlibModulePath {
+		return stdlib.Contains(importPath)
+	}
+	rest, ok := strings.CutPrefix(importPath, modulePath)
+	return ok && (rest == "" || rest[0] == '/')
+}
+
+func (c *Cache) expired(page *Page) bool {
+	return c.ttl > 0 && time.Since(page.Created) > c.ttl
+}
+
+// add adds the page, stored in the store at the given time, to the cache
+// and evicts the least recently used pages to stay within the size limit.
+// c.mu must be held.
+func (c *Cache) add(key Key, page *Page, stored time.Time) {
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	size := int64(len(page.Body))
+	if size > c.maxSize {
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&entry{key, page, stored})
+	c.size += size
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove removes the element from the cache. c.mu must be held.
+func (c *Cache) remove(e *list.Element) {
+	ent := c.lru.Remove(e).(*entry)
+	delete(c.entries, ent.key)
+	c.size -= int64(len(ent.page.Body))
+}
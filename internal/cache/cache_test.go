@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func page(body string) *Page {
+	header := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	return &Page{Header: header, Body: []byte(body), Created: time.Now()}
+}
+
+func TestCache(t *testing.T) {
+	c := New(10, 0, nil)
+	a := Key{"linux/amd64", "example.com/m/a", "v1.0.0", ""}
+	b := Key{"linux/amd64", "example.com/m/b", "v1.0.0", ""}
+	d := Key{"linux/amd64", "example.com/other", "v1.0.0", ""}
+
+	c.Put(a, page("aaaa"), c.Generation())
+	c.Put(b, page("bbbb"), c.Generation())
+	if p := c.Get(a); p == nil || string(p.Body) != "aaaa" {
+		t.Fatalf("Get(a) = %v, want aaaa", p)
+	}
+	// b is now the least recently used page and is evicted
+	c.Put(d, page("dddd"), c.Generation())
+	if c.Get(b) != nil {
+		t.Error("Get(b) after eviction returned a page")
+	}
+	if c.Get(a) == nil || c.Get(d) == nil {
+		t.Error("Get after eviction of b missed a or d")
+	}
+	c.Put(b, page(strings.Repeat("b", 11)), c.Generation())
+	if c.Get(b) != nil {
+		t.Error("Get returned page larger than the cache")
+	}
+
+	gen := c.Generation()
+	c.Invalidate("example.com/m")
+	if c.Get(a) != nil {
+		t.Error("Get(a) after Invalidate returned a page")
+	}
+	if c.Get(d) == nil {
+		t.Error("Get(d) after Invalidate of another module missed")
+	}
+	c.Put(a, page("aaaa"), gen)
+	if c.Get(a) != nil {
+		t.Error("Get returned page rendered before Invalidate")
+	}
+
+	var nilCache *Cache
+	nilCache.Put(a, page("aaaa"), nilCache.Generation())
+	if nilCache.Get(a) != nil {
+		t.Error("nil Cache returned a page")
+	}
+	nilCache.Invalidate("example.com/m")
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := New(100, time.Minute, nil)
+	key := Key{"linux/amd64", "example.com/m", "v1.0.0", ""}
+	old := page("old")
+	old.Created = time.Now().Add(-2 * time.Minute)
+	c.Put(key, old, c.Generation())
+	if c.Get(key) != nil {
+		t.Error("Get returned expired page")
+	}
+}
+
+func TestInModule(t *testing.T) {
+	for _, test := range []struct {
+		importPath, modulePath string
+		want                   bool
+	}{
+		{"example.com/m", "example.com/m", true},
+		{"example.com/m/sub", "example.com/m", true},
+		{"example.com/mod", "example.com/m", false},
+		{"net/http", "std", true},
+		{"cmd/go", "std", true},
+		{"example.com/m", "std", false},
+	} {
+		if got := InModule(test.importPath, test.modulePath); got != test.want {
+			t.Errorf("InModule(%q, %q) = %v, want %v", test.importPath, test.modulePath, got, test.want)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	store := FileStore{Dir: t.TempDir()}
+	keys := []Key{
+		{"linux/amd64", "example.com/M/a", "v1.0.0", ""},
+		{"linux/amd64", "example.com/M/a", "v1.0.0", "versions"},
+		{"linux/amd64", "net/http", "latest", ""},
+	}
+	for _, key := range keys {
+		if err := store.Put(key, page(key.ImportPath+" "+key.View)); err != nil {
+			t.Fatalf("Put(%v): %v", key, err)
+		}
+	}
+	for _, key := range keys {
+		p, err := store.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%v): %v", key, err)
+		}
+		if want := key.ImportPath + " " + key.View; p == nil || string(p.Body) != want {
+			t.Errorf("Get(%v) = %v, want %q", key, p, want)
+		}
+	}
+
+	if err := store.Invalidate("example.com/M"); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := store.Get(keys[0]); err != nil || p != nil {
+		t.Errorf("Get after Invalidate = %v, %v, want nil", p, err)
+	}
+	if p, err := store.Get(keys[2]); err != nil || p == nil {
+		t.Errorf("Get of another module after Invalidate = %v, %v", p, err)
+	}
+	if err := store.Invalidate("std"); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := store.Get(keys[2]); err != nil || p != nil {
+		t.Errorf("Get after Invalidate(std) = %v, %v, want nil", p, err)
+	}
+
+	// Pages in the store are added to the in-memory cache
+	c := New(100, 0, store)
+	c.Put(keys[0], page("a"), c.Generation())
+	if p := New(100, 0, store).Get(keys[0]); p == nil || string(p.Body) != "a" {
+		t.Errorf("Get from shared store = %v, want a", p)
+	}
+}
+
+func TestCacheSharedStore(t *testing.T) {
+	store := FileStore{Dir: t.TempDir()}
+	key := Key{"linux/amd64", "example.com/m", "v1.0.0", ""}
+	c1 := New(100, 0, store)
+	c2 := New(100, 0, store)
+	c1.Put(key, page("old"), c1.Generation())
+	if p := c1.Get(key); p == nil || string(p.Body) != "old" {
+		t.Fatalf("Get = %v, want old", p)
+	}
+
+	// Another server replaces the page
+	c2.Put(key, page("new"), c2.Generation())
+	// File modification times may be coarser than the interval between
+	// the writes
+	name, _ := store.file(key)
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(name, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if p := c1.Get(key); p == nil || string(p.Body) != "new" {
+		t.Errorf("Get after replacement by another cache = %v, want new", p)
+	}
+
+	// Another server invalidates the module
+	c2.Invalidate("example.com/m")
+	if p := c1.Get(key); p != nil {
+		t.Errorf("Get after invalidation by another cache = %v, want nil", p)
+	}
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/proxy"
+	"git.sr.ht/~sircmpwn/gddo/internal/stdlib"
+	"golang.org/x/mod/module"
+)
+
+// FileStore is a Store which keeps pages in files under a directory, which
+// may be shared by several servers on the same host. The pages of a package
+// are kept in a directory named after its escaped import path, so that the
+// pages of a module can be removed together.
+type FileStore struct {
+	Dir string
+}
+
+// Get implements the Store interface.
+func (s FileStore) Get(key Key) (*Page, error) {
+	name, ok := s.file(key)
+	if !ok {
+		return nil, nil
+	}
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	page := new(Page)
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(page); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return page, nil
+}
+
+// Put implements the Store interface.
+func (s FileStore) Put(key Key, page *Page) error {
+	name, ok := s.file(key)
+	if !ok {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(page); err != nil {
+		return err
+	}
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so that readers never see a
+	// partially written page
+	f, err := os.CreateTemp(dir, ".page-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// ModTime implements the Store interface.
+func (s FileStore) ModTime(key Key) (time.Time, error) {
+	name, ok := s.file(key)
+	if !ok {
+		return time.Time{}, nil
+	}
+	fi, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// Invalidate implements the Store interface.
+func (s FileStore) Invalidate(modulePath string) error {
+	dir, ok := s.dir(modulePath)
+	if !ok {
+		return nil
+	}
+	return os.RemoveAll(dir)
+}
+
+// dir returns the directory holding the pages of the package or module.
+func (s FileStore) dir(path string) (string, bool) {
+	if path == proxy.StdlibModulePath {
+		return filepath.Join(s.Dir, "std"), true
+	}
+	if stdlib.Contains(path) {
+		return filepath.Join(s.Dir, "std", filepath.FromSlash(path)), true
+	}
+	escaped, err := module.EscapePath(path)
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(escaped)), true
+}
+
+// file returns the name of the file holding the page for the key.
+func (s FileStore) file(key Key) (string, bool) {
+	dir, ok := s.dir(key.ImportPath)
+	if !ok {
+		return "", false
+	}
+	sum := sha1.Sum([]byte(key.Platform + "\x00" + key.Version + "\x00" + key.View))
+	return filepath.Join(dir, fmt.Sprintf("%x.page", sum)), true
+}
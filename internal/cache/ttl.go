@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// A TTLMap caches values of up to a maximum number of keys, each for a
+// fixed time. When it is full, expired values are removed, or all values if
+// none have expired. It is safe for concurrent use.
+type TTLMap[K comparable, V any] struct {
+	ttl time.Duration
+	max int
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[K]ttlEntry[V]
+}
+
+type ttlEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// NewTTLMap returns a map caching values of up to max keys for ttl.
+func NewTTLMap[K comparable, V any](ttl time.Duration, max int) *TTLMap[K, V] {
+	return &TTLMap[K, V]{
+		ttl:     ttl,
+		max:     max,
+		now:     time.Now,
+		entries: make(map[K]ttlEntry[V]),
+	}
+}
+
+// Get returns the value cached for the key and reports whether it was
+// found and has not expired.
+func (m *TTLMap[K, V]) Get(key K) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok || !m.now().Before(e.expires) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Put caches the value for the key.
+func (m *TTLMap[K, V]) Put(key K, value V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if _, ok := m.entries[key]; !ok && len(m.entries) >= m.max {
+		for k, e := range m.entries {
+			if !now.Before(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+		if len(m.entries) >= m.max {
+			clear(m.entries)
+		}
+	}
+	m.entries[key] = ttlEntry[V]{value, now.Add(m.ttl)}
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLMap(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m := NewTTLMap[string, int](time.Minute, 2)
+	m.now = func() time.Time { return now }
+
+	m.Put("a", 1)
+	if v, ok := m.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %v, %v, want 1, true", v, ok)
+	}
+	if _, ok := m.Get("b"); ok {
+		t.Error("Get of missing key succeeded")
+	}
+
+	now = now.Add(30 * time.Second)
+	m.Put("b", 2)
+	now = now.Add(30 * time.Second)
+	if _, ok := m.Get("a"); ok {
+		t.Error("Get of expired value succeeded")
+	}
+
+	// The expired value of a makes room for c
+	m.Put("c", 3)
+	if _, ok := m.Get("b"); !ok {
+		t.Error("value of b was removed before it expired")
+	}
+	// No values have expired, so all are removed to make room for d
+	m.Put("d", 4)
+	if _, ok := m.Get("b"); ok {
+		t.Error("full map kept b")
+	}
+	if v, ok := m.Get("d"); !ok || v != 4 {
+		t.Errorf("Get(d) = %v, %v, want 4, true", v, ok)
+	}
+}
@@ -4,26 +4,52 @@ package database
 // See schema.sql for the database schema.
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"go/doc"
+	"html/template"
+	"io"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
 	"git.sr.ht/~sircmpwn/gddo/internal"
 	"git.sr.ht/~sircmpwn/gddo/internal/autodiscovery"
+	"git.sr.ht/~sircmpwn/gddo/internal/godoc"
+	"git.sr.ht/~sircmpwn/gddo/internal/licenses"
+	"git.sr.ht/~sircmpwn/gddo/internal/readme"
+	"git.sr.ht/~sircmpwn/gddo/internal/render"
+	"git.sr.ht/~sircmpwn/gddo/internal/webhook"
 	"github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
 	promcollectors "github.com/prometheus/client_golang/prometheus/collectors"
+	"golang.org/x/mod/semver"
 )
 
 // Package contains package-level information and source code.
 type Package struct {
 	internal.Module
-	Source []byte // encoded Go source files
-	Error  string
+	Source   []byte          // encoded Go source files
+	Links    godoc.Links     // resolved identifier links
+	Promoted godoc.Promoted  // members promoted from embedded types
+	Warnings []godoc.Warning // problems found in the documentation
+
+	// Pre-rendered declarations and examples, nil if they were not
+	// stored or could not be decoded
+	Fragments *render.Fragments
+
+	// LicensesDetected reports whether the license files of the module
+	// were detected when the package was fetched. Packages fetched before
+	// license files were stored have no license information.
+	LicensesDetected bool
+
+	Error string
 }
 
 // Synopsis is a shorthand version of a package useful for package listings.
@@ -39,18 +65,42 @@ type Database struct {
 	countModules     *sql.Stmt
 	insertModule     *sql.Stmt
 	touchModule      *sql.Stmt
+	moduleQuery      *sql.Stmt
+	lockModule       *sql.Stmt
+	insertEvent      *sql.Stmt
+	takeEvents       *sql.Stmt
+	modulePathQuery  *sql.Stmt
 	searchQuery      *sql.Stmt
 	packageQuery     *sql.Stmt
 	latestQuery      *sql.Stmt
 	insertPackage    *sql.Stmt
+	updateFragments  *sql.Stmt
+	versionList      *sql.Stmt
+	versionsQuery    *sql.Stmt
+	recentQuery      *sql.Stmt
 	packageExists    *sql.Stmt
 	blockExists      *sql.Stmt
+	failureQuery     *sql.Stmt
+	insertFailure    *sql.Stmt
+	expireFailures   *sql.Stmt
+	deleteFailures   *sql.Stmt
 	synopsesQuery    *sql.Stmt
 	directoriesQuery *sql.Stmt
 	projectQuery     *sql.Stmt
 	projectUpdated   *sql.Stmt
 	insertProject    *sql.Stmt
 	oldestModule     *sql.Stmt
+	licensesQuery    *sql.Stmt
+	insertLicense    *sql.Stmt
+	licensesDetected *sql.Stmt
+	readmeQuery      *sql.Stmt
+	insertReadme     *sql.Stmt
+	updateReadme     *sql.Stmt
+	sourceFiles      *sql.Stmt
+	insertSourceFile *sql.Stmt
+	implementsQuery  *sql.Stmt
+	implementers     *sql.Stmt
+	insertImplements *sql.Stmt
 }
 
 // New creates a new database. serverURI is the postgres URI.
@@ -82,6 +132,26 @@ func (db *Database) prepare() error {
 	if err != nil {
 		return err
 	}
+	db.moduleQuery, err = db.pg.Prepare(moduleQuery)
+	if err != nil {
+		return err
+	}
+	db.lockModule, err = db.pg.Prepare(lockModule)
+	if err != nil {
+		return err
+	}
+	db.insertEvent, err = db.pg.Prepare(insertEvent)
+	if err != nil {
+		return err
+	}
+	db.takeEvents, err = db.pg.Prepare(takeEvents)
+	if err != nil {
+		return err
+	}
+	db.modulePathQuery, err = db.pg.Prepare(modulePathQuery)
+	if err != nil {
+		return err
+	}
 	db.searchQuery, err = db.pg.Prepare(searchQuery)
 	if err != nil {
 		return err
@@ -98,6 +168,22 @@ func (db *Database) prepare() error {
 	if err != nil {
 		return err
 	}
+	db.updateFragments, err = db.pg.Prepare(updateFragments)
+	if err != nil {
+		return err
+	}
+	db.versionList, err = db.pg.Prepare(versionList)
+	if err != nil {
+		return err
+	}
+	db.versionsQuery, err = db.pg.Prepare(versionsQuery)
+	if err != nil {
+		return err
+	}
+	db.recentQuery, err = db.pg.Prepare(recentQuery)
+	if err != nil {
+		return err
+	}
 	db.packageExists, err = db.pg.Prepare(packageExists)
 	if err != nil {
 		return err
@@ -106,6 +192,22 @@ func (db *Database) prepare() error {
 	if err != nil {
 		return err
 	}
+	db.failureQuery, err = db.pg.Prepare(failureQuery)
+	if err != nil {
+		return err
+	}
+	db.insertFailure, err = db.pg.Prepare(insertFailure)
+	if err != nil {
+		return err
+	}
+	db.expireFailures, err = db.pg.Prepare(expireFailures)
+	if err != nil {
+		return err
+	}
+	db.deleteFailures, err = db.pg.Prepare(deleteFailures)
+	if err != nil {
+		return err
+	}
 	db.synopsesQuery, err = db.pg.Prepare(synopsesQuery)
 	if err != nil {
 		return err
@@ -130,6 +232,50 @@ func (db *Database) prepare() error {
 	if err != nil {
 		return err
 	}
+	db.licensesQuery, err = db.pg.Prepare(licensesQuery)
+	if err != nil {
+		return err
+	}
+	db.insertLicense, err = db.pg.Prepare(insertLicense)
+	if err != nil {
+		return err
+	}
+	db.licensesDetected, err = db.pg.Prepare(licensesDetected)
+	if err != nil {
+		return err
+	}
+	db.readmeQuery, err = db.pg.Prepare(readmeQuery)
+	if err != nil {
+		return err
+	}
+	db.insertReadme, err = db.pg.Prepare(insertReadme)
+	if err != nil {
+		return err
+	}
+	db.updateReadme, err = db.pg.Prepare(updateReadme)
+	if err != nil {
+		return err
+	}
+	db.sourceFiles, err = db.pg.Prepare(sourceFilesQuery)
+	if err != nil {
+		return err
+	}
+	db.insertSourceFile, err = db.pg.Prepare(insertSourceFile)
+	if err != nil {
+		return err
+	}
+	db.implementsQuery, err = db.pg.Prepare(implementsQuery)
+	if err != nil {
+		return err
+	}
+	db.implementers, err = db.pg.Prepare(implementersQuery)
+	if err != nil {
+		return err
+	}
+	db.insertImplements, err = db.pg.Prepare(insertImplements)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -182,26 +328,96 @@ func (db *Database) Modules(ctx context.Context) (int64, error) {
 
 const insertModule = `
 INSERT INTO modules (
-	module_path, series_path, latest_version, versions, deprecated, updated
+	module_path, series_path, latest_version, versions, deprecated,
+	retractions, updated
 ) VALUES (
-	$1, $2, $3, $4, $5, NOW()
+	$1, $2, $3, $4, $5, $6, NOW()
 ) ON CONFLICT (module_path) DO
-UPDATE SET series_path = $2, latest_version = $3, versions = $4, deprecated = $5, updated = NOW();
+UPDATE SET series_path = $2, latest_version = $3, versions = $4, deprecated = $5,
+	retractions = $6, updated = NOW();
 `
 
-// PutModule stores the module in the database.
-func (db *Database) PutModule(ctx context.Context, mod *internal.Module) error {
+const lockModule = `
+SELECT series_path, latest_version, versions, deprecated, retractions, updated
+FROM modules WHERE module_path = $1 FOR UPDATE;
+`
+
+const insertEvent = `INSERT INTO webhook_events (module_path, event) VALUES ($1, $2);`
+
+const takeEvents = `
+WITH taken AS (
+	DELETE FROM webhook_events WHERE module_path = $1 RETURNING id, event
+)
+SELECT event FROM taken ORDER BY id;
+`
+
+// PutModule stores the module in the database. If changes is not nil, the
+// webhook events it returns for the module replaced, or nil if the module
+// did not exist, are queued in the same transaction, until they are taken
+// by TakeEvents. Concurrent calls for the same module are serialized, so
+// that each sees the module stored by the one before.
+func (db *Database) PutModule(ctx context.Context, mod *internal.Module, changes func(prev *internal.Module) []webhook.Event) error {
+	retractions, err := json.Marshal(mod.Retractions)
+	if err != nil {
+		return err
+	}
 	return db.WithTx(ctx, nil, func(tx *sql.Tx) error {
-		_, err := tx.Stmt(db.insertModule).Exec(
+		prev, err := scanModule(tx.Stmt(db.lockModule).QueryRow(mod.ModulePath), mod.ModulePath)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Stmt(db.insertModule).Exec(
 			mod.ModulePath, mod.SeriesPath, mod.LatestVersion,
-			pq.StringArray(mod.Versions), mod.Deprecated)
+			pq.StringArray(mod.Versions), mod.Deprecated, retractions)
 		if err != nil {
 			return err
 		}
+		if changes == nil {
+			return nil
+		}
+		stmt := tx.Stmt(db.insertEvent)
+		for _, ev := range changes(prev) {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.Exec(mod.ModulePath, data); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 }
 
+// TakeEvents removes the webhook events queued for the module from the
+// database and returns them, oldest first.
+func (db *Database) TakeEvents(ctx context.Context, modulePath string) ([]webhook.Event, error) {
+	var events []webhook.Event
+	err := db.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		rows, err := tx.Stmt(db.takeEvents).Query(modulePath)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var data []byte
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+			var ev webhook.Event
+			if err := json.Unmarshal(data, &ev); err != nil {
+				return err
+			}
+			events = append(events, ev)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
 const touchModule = `UPDATE modules SET updated = NOW() WHERE module_path = $1;`
 
 // TouchModule updates the module's updated timestamp.
@@ -216,6 +432,74 @@ func (db *Database) TouchModule(ctx context.Context, modulePath string) error {
 	})
 }
 
+const moduleQuery = `
+SELECT series_path, latest_version, versions, deprecated, retractions, updated
+FROM modules WHERE module_path = $1;
+`
+
+// Module returns the module with the given path, as last stored with
+// PutModule. If the module does not exist, Module returns nil.
+func (db *Database) Module(ctx context.Context, modulePath string) (*internal.Module, error) {
+	var mod *internal.Module
+	err := db.WithTx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	}, func(tx *sql.Tx) error {
+		var err error
+		mod, err = scanModule(tx.Stmt(db.moduleQuery).QueryRow(modulePath), modulePath)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mod, nil
+}
+
+// scanModule scans the module with the given path from a row of moduleQuery
+// or lockModule. If there is no row, scanModule returns nil.
+func scanModule(row *sql.Row, modulePath string) (*internal.Module, error) {
+	mod := &internal.Module{ModulePath: modulePath}
+	var retractions []byte
+	err := row.Scan(&mod.SeriesPath, &mod.LatestVersion,
+		(*pq.StringArray)(&mod.Versions), &mod.Deprecated,
+		&retractions, &mod.Updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(retractions) > 0 {
+		if err := json.Unmarshal(retractions, &mod.Retractions); err != nil {
+			return nil, err
+		}
+	}
+	mod.Version = mod.LatestVersion
+	return mod, nil
+}
+
+const modulePathQuery = `
+SELECT module_path FROM modules WHERE lower(module_path) = lower($1)
+ORDER BY module_path = $1 DESC
+LIMIT 1;
+`
+
+// ModulePath returns the path of the module in the database whose path
+// matches the given path regardless of case, or the given path if there
+// is none.
+func (db *Database) ModulePath(ctx context.Context, modulePath string) (string, error) {
+	result := modulePath
+	err := db.WithTx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	}, func(tx *sql.Tx) error {
+		row := tx.Stmt(db.modulePathQuery).QueryRow(modulePath)
+		return row.Scan(&result)
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return result, nil
+}
+
 const searchQuery = `
 SELECT p.import_path, p.synopsis
 FROM packages p, modules m
@@ -254,8 +538,9 @@ func (db *Database) Search(ctx context.Context, platform, query string) ([]Synop
 const packageQuery = `
 SELECT
 	p.module_path, p.series_path, p.version, p.reference, p.commit_time,
-	p.source, p.error,
-	m.latest_version, m.versions, m.deprecated, m.updated
+	p.source, p.links, p.promoted, p.warnings, p.rendered,
+	p.licenses_detected, p.error,
+	m.latest_version, m.versions, m.deprecated, m.retractions, m.updated
 FROM packages p, modules m
 WHERE p.platform = $1 AND p.import_path = $2 AND p.version = $3
 	AND m.module_path = p.module_path;
@@ -264,8 +549,9 @@ WHERE p.platform = $1 AND p.import_path = $2 AND p.version = $3
 const latestQuery = `
 SELECT
 	p.module_path, p.series_path, p.version, p.reference, p.commit_time,
-	p.source, p.error,
-	m.latest_version, m.versions, m.deprecated, m.updated
+	p.source, p.links, p.promoted, p.warnings, p.rendered,
+	p.licenses_detected, p.error,
+	m.latest_version, m.versions, m.deprecated, m.retractions, m.updated
 FROM packages p, modules m
 WHERE p.platform = $1 AND p.import_path = $2 AND m.module_path = p.module_path
 	AND p.version = m.latest_version;
@@ -275,6 +561,7 @@ WHERE p.platform = $1 AND p.import_path = $2 AND m.module_path = p.module_path
 // It may return nil if no such package was found.
 func (db *Database) Package(ctx context.Context, platform, importPath, version string) (*Package, error) {
 	var pkg Package
+	var retractions, links, promoted, warnings, rendered []byte
 	err := db.WithTx(ctx, &sql.TxOptions{
 		ReadOnly: true,
 	}, func(tx *sql.Tx) error {
@@ -287,11 +574,37 @@ func (db *Database) Package(ctx context.Context, platform, importPath, version s
 
 		if err := row.Scan(&pkg.ModulePath, &pkg.SeriesPath,
 			&pkg.Version, &pkg.Reference, &pkg.CommitTime,
-			&pkg.Source, &pkg.Error,
+			&pkg.Source, &links, &promoted, &warnings, &rendered,
+			&pkg.LicensesDetected, &pkg.Error,
 			&pkg.LatestVersion, (*pq.StringArray)(&pkg.Versions),
-			&pkg.Deprecated, &pkg.Updated); err != nil {
+			&pkg.Deprecated, &retractions, &pkg.Updated); err != nil {
 			return err
 		}
+		if len(retractions) > 0 {
+			if err := json.Unmarshal(retractions, &pkg.Retractions); err != nil {
+				return err
+			}
+		}
+		if len(links) > 0 {
+			if err := json.Unmarshal(links, &pkg.Links); err != nil {
+				return err
+			}
+		}
+		if len(promoted) > 0 {
+			if err := json.Unmarshal(promoted, &pkg.Promoted); err != nil {
+				return err
+			}
+		}
+		if len(warnings) > 0 {
+			if err := json.Unmarshal(warnings, &pkg.Warnings); err != nil {
+				return err
+			}
+		}
+		if len(rendered) > 0 {
+			// Fragments which cannot be decoded, for example because
+			// they were stored by another format version, are rebuilt
+			pkg.Fragments = decodeFragments(rendered)
+		}
 		if importPath != pkg.ModulePath {
 			// Filter available versions
 			stmt := tx.Stmt(db.packageExists)
@@ -324,32 +637,104 @@ func (db *Database) Package(ctx context.Context, platform, importPath, version s
 const insertPackage = `
 INSERT INTO packages (
 	platform, import_path, module_path, series_path, version, reference,
-	commit_time, imports, name, synopsis, score, source, error
+	commit_time, imports, name, synopsis, score, source, links, promoted,
+	warnings, rendered, api, licenses_detected, error
 ) VALUES (
-	$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+	$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
+	TRUE, $18
 );
 `
 
-// PutPackage stores the package in the database.
-func (db *Database) PutPackage(tx *sql.Tx, platform string, mod *internal.Module, pkg *doc.Package, source []byte) error {
+// PutPackage stores the package in the database. info holds the results of
+// analyzing the package and fragments its pre-rendered documentation, and
+// either may be nil.
+func (db *Database) PutPackage(tx *sql.Tx, platform string, mod *internal.Module, pkg *doc.Package, source []byte, info *godoc.Info, fragments *render.Fragments) error {
 	synopsis := pkg.Synopsis(pkg.Doc)
 	score := searchScore(pkg)
 
-	_, err := tx.Stmt(db.insertPackage).Exec(
+	if info == nil {
+		info = &godoc.Info{}
+	}
+	linksJSON, err := json.Marshal(info.Links)
+	if err != nil {
+		return err
+	}
+	promotedJSON, err := json.Marshal(info.Promoted)
+	if err != nil {
+		return err
+	}
+	warningsJSON, err := json.Marshal(info.Warnings)
+	if err != nil {
+		return err
+	}
+	apiJSON, err := json.Marshal(info.API)
+	if err != nil {
+		return err
+	}
+	rendered, err := encodeFragments(fragments)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Stmt(db.insertPackage).Exec(
 		platform, pkg.ImportPath, mod.ModulePath, mod.SeriesPath, mod.Version,
 		mod.Reference, mod.CommitTime, pq.StringArray(pkg.Imports), pkg.Name,
-		synopsis, score, source, "")
+		synopsis, score, source, linksJSON, promotedJSON, warningsJSON,
+		rendered, apiJSON, "")
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+const updateFragments = `
+UPDATE packages SET rendered = $4
+WHERE platform = $1 AND import_path = $2 AND version = $3;
+`
+
+// PutFragments replaces the pre-rendered documentation of the package.
+func (db *Database) PutFragments(ctx context.Context, platform, importPath, version string, fragments *render.Fragments) error {
+	rendered, err := encodeFragments(fragments)
+	if err != nil {
+		return err
+	}
+	return db.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		_, err := tx.Stmt(db.updateFragments).Exec(platform, importPath, version, rendered)
+		return err
+	})
+}
+
+// encodeFragments encodes pre-rendered documentation as compressed JSON.
+func encodeFragments(fragments *render.Fragments) ([]byte, error) {
+	if fragments == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(fragments)
+	if err != nil {
+		return nil, err
+	}
+	return compress(data)
+}
+
+// decodeFragments decodes pre-rendered documentation encoded with
+// encodeFragments. It returns nil if the data cannot be decoded.
+func decodeFragments(data []byte) *render.Fragments {
+	data, err := decompress(data)
+	if err != nil {
+		return nil
+	}
+	var fragments render.Fragments
+	if err := json.Unmarshal(data, &fragments); err != nil {
+		return nil
+	}
+	return &fragments
+}
+
 // PutDirectory stores the directory in the database.
 func (db *Database) PutDirectory(tx *sql.Tx, platform string, mod *internal.Module, importPath string, errorMsg string) error {
 	_, err := tx.Stmt(db.insertPackage).Exec(
 		platform, importPath, mod.ModulePath, mod.SeriesPath, mod.Version,
-		mod.Reference, mod.CommitTime, nil, "", "", 0, nil, errorMsg)
+		mod.Reference, mod.CommitTime, nil, "", "", 0, nil, nil, nil, nil, nil,
+		nil, errorMsg)
 	if err != nil {
 		return err
 	}
@@ -385,6 +770,10 @@ func searchScore(pkg *doc.Package) float64 {
 			r *= 0.95
 		}
 	}
+	if godoc.IsDeprecated(pkg.Doc) {
+		// Penalty for deprecated packages.
+		r *= 0.5
+	}
 	return r
 }
 
@@ -438,6 +827,73 @@ func (db *Database) IsBlocked(ctx context.Context, importPath string) (bool, err
 	return blocked, nil
 }
 
+const failureQuery = `
+SELECT reason FROM fetch_failures
+WHERE platform = $1 AND import_path = $2 AND version = $3 AND expires > NOW();
+`
+
+// FetchFailure returns the reason why fetching the given version of the
+// import path failed, or the empty string if no failure is remembered or
+// the failure has expired.
+func (db *Database) FetchFailure(ctx context.Context, platform, importPath, version string) (string, error) {
+	var reason string
+	err := db.WithTx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	}, func(tx *sql.Tx) error {
+		row := tx.Stmt(db.failureQuery).QueryRow(platform, importPath, version)
+		if err := row.Scan(&reason); err != nil {
+			return err
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return reason, nil
+}
+
+const insertFailure = `
+INSERT INTO fetch_failures (
+	platform, import_path, version, reason, expires
+) VALUES (
+	$1, $2, $3, $4, NOW() + $5 * interval '1 second'
+) ON CONFLICT (platform, import_path, version) DO
+UPDATE SET reason = $4, expires = NOW() + $5 * interval '1 second';
+`
+
+const expireFailures = `DELETE FROM fetch_failures WHERE expires <= NOW();`
+
+// PutFetchFailure remembers that fetching the given version of the import
+// path failed for the given reason, until the ttl elapses. Expired failures
+// are removed.
+func (db *Database) PutFetchFailure(ctx context.Context, platform, importPath, version, reason string, ttl time.Duration) error {
+	return db.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		if _, err := tx.Stmt(db.expireFailures).Exec(); err != nil {
+			return err
+		}
+		_, err := tx.Stmt(db.insertFailure).Exec(platform, importPath, version,
+			reason, int64(ttl/time.Second))
+		return err
+	})
+}
+
+const deleteFailures = `
+DELETE FROM fetch_failures
+WHERE import_path = $1 OR import_path LIKE replace($1, '_', '\_') || '/%';
+`
+
+// DeleteFetchFailures forgets the failures to fetch the import path and
+// the import paths below it, on all platforms.
+func (db *Database) DeleteFetchFailures(ctx context.Context, importPath string) error {
+	return db.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		_, err := tx.Stmt(db.deleteFailures).Exec(importPath)
+		return err
+	})
+}
+
 const synopsesQuery = `
 SELECT p.import_path, p.synopsis
 FROM packages p, modules m
@@ -522,6 +978,156 @@ func (db *Database) Directories(ctx context.Context, platform, modulePath, versi
 	return results, nil
 }
 
+const versionList = `
+SELECT DISTINCT version FROM packages
+WHERE platform = $1 AND module_path = $2;
+`
+
+const versionsQuery = `
+SELECT version, import_path, name, commit_time, api FROM packages
+WHERE platform = $1 AND module_path = $2 AND version = ANY($3);
+`
+
+// A ModuleVersion describes a version of a module in the database.
+type ModuleVersion struct {
+	Version    string
+	CommitTime time.Time
+
+	// The exported APIs of the packages of the version keyed by import
+	// path, or nil if they were not recorded when it was fetched
+	APIs map[string]godoc.API
+}
+
+// ModuleVersions returns the n newest versions of the module whose packages
+// are in the database, newest first.
+func (db *Database) ModuleVersions(ctx context.Context, platform, modulePath string, n int) ([]*ModuleVersion, error) {
+	var list []string
+	versions := make(map[string]*ModuleVersion)
+	unknown := make(map[string]bool) // versions without recorded APIs
+	err := db.WithTx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	}, func(tx *sql.Tx) error {
+		rows, err := tx.Stmt(db.versionList).Query(platform, modulePath)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version string
+			if err := rows.Scan(&version); err != nil {
+				return err
+			}
+			list = append(list, version)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return semver.Compare(list[i], list[j]) > 0
+		})
+		if len(list) > n {
+			list = list[:n]
+		}
+
+		rows, err = tx.Stmt(db.versionsQuery).Query(platform, modulePath, pq.Array(list))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version, importPath, name string
+			var commitTime time.Time
+			var api []byte
+			if err := rows.Scan(&version, &importPath, &name, &commitTime, &api); err != nil {
+				return err
+			}
+			v, ok := versions[version]
+			if !ok {
+				v = &ModuleVersion{
+					Version:    version,
+					CommitTime: commitTime,
+					APIs:       make(map[string]godoc.API),
+				}
+				versions[version] = v
+			}
+			if name == "" {
+				// Directory without a package
+				continue
+			}
+			var pkgAPI godoc.API
+			if len(api) > 0 {
+				if err := json.Unmarshal(api, &pkgAPI); err != nil {
+					return err
+				}
+			}
+			if pkgAPI == nil {
+				unknown[version] = true
+				continue
+			}
+			v.APIs[importPath] = pkgAPI
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	for version := range unknown {
+		versions[version].APIs = nil
+	}
+	result := make([]*ModuleVersion, 0, len(list))
+	for _, version := range list {
+		if v := versions[version]; v != nil {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+const recentQuery = `
+SELECT module_path, version, synopsis, commit_time, created FROM packages
+WHERE platform = $1 AND import_path = module_path
+ORDER BY created DESC
+LIMIT $2;
+`
+
+// A RecentModule is a recently indexed version of a module.
+type RecentModule struct {
+	ModulePath string
+	Version    string
+	Synopsis   string
+	CommitTime time.Time
+	Created    time.Time // when the version was indexed
+}
+
+// RecentModules returns up to limit of the most recently indexed module
+// versions, most recent first.
+func (db *Database) RecentModules(ctx context.Context, platform string, limit int) ([]RecentModule, error) {
+	var results []RecentModule
+	err := db.WithTx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	}, func(tx *sql.Tx) error {
+		rows, err := tx.Stmt(db.recentQuery).Query(platform, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var res RecentModule
+			if err := rows.Scan(&res.ModulePath, &res.Version, &res.Synopsis,
+				&res.CommitTime, &res.Created); err != nil {
+				return err
+			}
+			results = append(results, res)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 const projectQuery = `
 SELECT summary, dir, file, rawfile, line FROM projects WHERE module_path = $1;
 `
@@ -627,3 +1233,363 @@ func (db *Database) Oldest(ctx context.Context) (string, time.Time, error) {
 	}
 	return modulePath, timestamp, nil
 }
+
+const licensesQuery = `
+SELECT file_path, types, contents FROM licenses
+WHERE module_path = $1 AND version = $2
+ORDER BY file_path;
+`
+
+// Licenses returns the license files of the given module version.
+func (db *Database) Licenses(ctx context.Context, modulePath, version string) ([]*licenses.License, error) {
+	var results []*licenses.License
+	err := db.WithTx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	}, func(tx *sql.Tx) error {
+		rows, err := tx.Stmt(db.licensesQuery).Query(modulePath, version)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var lic licenses.License
+			if err := rows.Scan(&lic.FilePath, (*pq.StringArray)(&lic.Types),
+				&lic.Contents); err != nil {
+				return err
+			}
+			results = append(results, &lic)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+const insertLicense = `
+INSERT INTO licenses (
+	module_path, version, file_path, types, contents
+) VALUES (
+	$1, $2, $3, $4, $5
+) ON CONFLICT (module_path, version, file_path) DO
+UPDATE SET types = $4, contents = $5;
+`
+
+// PutLicenses stores the license files of the given module in the database.
+func (db *Database) PutLicenses(tx *sql.Tx, mod *internal.Module, lics []*licenses.License) error {
+	stmt := tx.Stmt(db.insertLicense)
+	for _, lic := range lics {
+		_, err := stmt.Exec(mod.ModulePath, mod.Version, lic.FilePath,
+			pq.StringArray(lic.Types), lic.Contents)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const licensesDetected = `
+UPDATE packages SET licenses_detected = TRUE
+WHERE module_path = $1 AND version = $2;
+`
+
+// PutDetectedLicenses stores the license files of a module version which
+// was fetched before license files were stored, and records that they were
+// detected.
+func (db *Database) PutDetectedLicenses(ctx context.Context, mod *internal.Module, lics []*licenses.License) error {
+	return db.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		if err := db.PutLicenses(tx, mod, lics); err != nil {
+			return err
+		}
+		_, err := tx.Stmt(db.licensesDetected).Exec(mod.ModulePath, mod.Version)
+		return err
+	})
+}
+
+const readmeQuery = `
+SELECT file_path, contents, coalesce(html, '') FROM readmes
+WHERE module_path = $1 AND version = $2;
+`
+
+// Readme returns the README file of the given module version, or nil if the
+// module has no README file.
+func (db *Database) Readme(ctx context.Context, modulePath, version string) (*readme.Readme, error) {
+	var result *readme.Readme
+	err := db.WithTx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	}, func(tx *sql.Tx) error {
+		var r readme.Readme
+		err := tx.Stmt(db.readmeQuery).QueryRow(modulePath, version).Scan(
+			&r.FilePath, &r.Contents, &r.Rendered)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		result = &r
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+const insertReadme = `
+INSERT INTO readmes (
+	module_path, version, file_path, contents, html
+) VALUES (
+	$1, $2, $3, $4, $5
+) ON CONFLICT (module_path, version) DO
+UPDATE SET file_path = $3, contents = $4, html = $5;
+`
+
+// PutReadme stores the README file of the given module in the database,
+// together with its rendered HTML. It does nothing if r is nil.
+func (db *Database) PutReadme(tx *sql.Tx, mod *internal.Module, r *readme.Readme) error {
+	if r == nil {
+		return nil
+	}
+	_, err := tx.Stmt(db.insertReadme).Exec(mod.ModulePath, mod.Version,
+		r.FilePath, r.Contents, string(r.Rendered))
+	return err
+}
+
+const updateReadme = `
+UPDATE readmes SET html = $3
+WHERE module_path = $1 AND version = $2;
+`
+
+// PutReadmeHTML replaces the rendered HTML of the README file of the given
+// module version.
+func (db *Database) PutReadmeHTML(ctx context.Context, modulePath, version string, html template.HTML) error {
+	return db.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		_, err := tx.Stmt(db.updateReadme).Exec(modulePath, version, string(html))
+		return err
+	})
+}
+
+const sourceFilesQuery = `
+SELECT name, contents FROM source_files
+WHERE module_path = $1 AND version = $2 AND dir = $3;
+`
+
+// SourceFiles returns the contents of the Go source files in the given
+// directory of a module version, keyed by file name. The directory is
+// relative to the module root.
+func (db *Database) SourceFiles(ctx context.Context, modulePath, version, dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := db.WithTx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	}, func(tx *sql.Tx) error {
+		rows, err := tx.Stmt(db.sourceFiles).Query(modulePath, version, dir)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				name       string
+				compressed []byte
+			)
+			if err := rows.Scan(&name, &compressed); err != nil {
+				return err
+			}
+			contents, err := decompress(compressed)
+			if err != nil {
+				return fmt.Errorf("decompressing %s: %w", name, err)
+			}
+			files[name] = contents
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+const insertSourceFile = `
+INSERT INTO source_files (
+	module_path, version, dir, name, contents
+) VALUES (
+	$1, $2, $3, $4, $5
+) ON CONFLICT (module_path, version, dir, name) DO NOTHING;
+`
+
+// PutSourceFiles stores the Go source files of the given module in the
+// database. Files are keyed by their path relative to the module root.
+func (db *Database) PutSourceFiles(tx *sql.Tx, mod *internal.Module, files map[string][]byte) error {
+	stmt := tx.Stmt(db.insertSourceFile)
+	for pathname, contents := range files {
+		compressed, err := compress(contents)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec(mod.ModulePath, mod.Version, path.Dir(pathname),
+			path.Base(pathname), compressed)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const implementsQuery = `
+SELECT type_name, pointer, iface_path, iface_name FROM implements
+WHERE platform = $1 AND import_path = $2 AND version = $3
+ORDER BY type_name, iface_path, iface_name;
+`
+
+// Implements returns the interfaces implemented by the types of the given
+// package, keyed by type name.
+func (db *Database) Implements(ctx context.Context, platform, importPath, version string) (map[string][]godoc.Implementation, error) {
+	impls := make(map[string][]godoc.Implementation)
+	err := db.WithTx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	}, func(tx *sql.Tx) error {
+		rows, err := tx.Stmt(db.implementsQuery).Query(platform, importPath, version)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var impl godoc.Implementation
+			if err := rows.Scan(&impl.Type, &impl.Pointer,
+				&impl.IfacePath, &impl.IfaceName); err != nil {
+				return err
+			}
+			impls[impl.Type] = append(impls[impl.Type], impl)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return impls, nil
+}
+
+// An Implementer is a type which implements an interface.
+type Implementer struct {
+	ImportPath string
+	Name       string
+	Pointer    bool // only a pointer to the type implements the interface
+}
+
+// Implementers are the known types which implement an interface.
+type Implementers struct {
+	Types []Implementer
+	// More reports whether there are more than the listed MaxImplementers
+	// types.
+	More bool
+}
+
+// MaxImplementers is the maximum number of implementers returned for each
+// interface.
+const MaxImplementers = 100
+
+const implementersQuery = `
+SELECT iface_name, import_path, type_name, pointer FROM (
+	SELECT i.iface_name, i.import_path, i.type_name, i.pointer,
+		row_number() OVER (PARTITION BY i.iface_name
+			ORDER BY i.import_path, i.type_name) AS n
+	FROM implements i, modules m
+	WHERE i.platform = $1 AND i.iface_path = $2
+		AND m.module_path = i.module_path AND i.version = m.latest_version
+) t
+WHERE n <= $3
+ORDER BY iface_name, import_path, type_name;
+`
+
+// Implementers returns the known types which implement the interfaces of the
+// given package, keyed by interface name. Only the latest versions of
+// implementing packages are considered.
+func (db *Database) Implementers(ctx context.Context, platform, importPath string) (map[string]*Implementers, error) {
+	impls := make(map[string]*Implementers)
+	err := db.WithTx(ctx, &sql.TxOptions{
+		ReadOnly: true,
+	}, func(tx *sql.Tx) error {
+		// One more row than listed tells whether there are more
+		rows, err := tx.Stmt(db.implementers).Query(platform, importPath, MaxImplementers+1)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				iface string
+				impl  Implementer
+			)
+			if err := rows.Scan(&iface, &impl.ImportPath,
+				&impl.Name, &impl.Pointer); err != nil {
+				return err
+			}
+			list := impls[iface]
+			if list == nil {
+				list = &Implementers{}
+				impls[iface] = list
+			}
+			if len(list.Types) == MaxImplementers {
+				list.More = true
+				continue
+			}
+			list.Types = append(list.Types, impl)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return impls, nil
+}
+
+const insertImplements = `
+INSERT INTO implements (
+	platform, import_path, version, module_path, type_name, pointer,
+	iface_path, iface_name
+) VALUES (
+	$1, $2, $3, $4, $5, $6, $7, $8
+) ON CONFLICT DO NOTHING;
+`
+
+// PutImplements stores the interfaces implemented by the types of the given
+// package in the database.
+func (db *Database) PutImplements(tx *sql.Tx, platform string, mod *internal.Module, importPath string, impls []godoc.Implementation) error {
+	stmt := tx.Stmt(db.insertImplements)
+	for _, impl := range impls {
+		_, err := stmt.Exec(platform, importPath, mod.Version, mod.ModulePath,
+			impl.Type, impl.Pointer, impl.IfacePath, impl.IfaceName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress compresses data with gzip.
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress decompresses gzip-compressed data.
+func decompress(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
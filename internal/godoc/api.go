@@ -0,0 +1,108 @@
+package godoc
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"go/ast"
+	"go/doc"
+	"go/printer"
+	"go/token"
+	"sort"
+)
+
+// An API maps the names of the exported declarations of a package, and of
+// the methods of its types as "T.M", to digests of their declarations.
+// Comparing the APIs of two versions of a package shows the declarations
+// which were added, removed or changed. Doc comments do not affect the
+// digests.
+type API map[string]string
+
+// NewAPI returns the API of the package documentation dpkg built from
+// sources in fset.
+func NewAPI(fset *token.FileSet, dpkg *doc.Package) API {
+	api := make(API)
+	add := func(name string, node ast.Node) {
+		var buf bytes.Buffer
+		if err := printer.Fprint(&buf, fset, node); err != nil {
+			return
+		}
+		sum := sha1.Sum(buf.Bytes())
+		api[name] = hex.EncodeToString(sum[:8])
+	}
+	values := func(values []*doc.Value) {
+		for _, v := range values {
+			for _, spec := range v.Decl.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for _, name := range vs.Names {
+					if token.IsExported(name.Name) {
+						add(name.Name, vs)
+					}
+				}
+			}
+		}
+	}
+	funcs := func(funcs []*doc.Func, recv string) {
+		for _, f := range funcs {
+			if !token.IsExported(f.Name) || f.Level > 0 {
+				continue
+			}
+			name := f.Name
+			if recv != "" {
+				name = recv + "." + f.Name
+			}
+			add(name, f.Decl)
+		}
+	}
+	values(dpkg.Consts)
+	values(dpkg.Vars)
+	funcs(dpkg.Funcs, "")
+	for _, t := range dpkg.Types {
+		values(t.Consts)
+		values(t.Vars)
+		funcs(t.Funcs, "")
+		if !token.IsExported(t.Name) {
+			continue
+		}
+		for _, spec := range t.Decl.Specs {
+			if ts := spec.(*ast.TypeSpec); ts.Name.Name == t.Name {
+				add(t.Name, ts)
+			}
+		}
+		funcs(t.Methods, t.Name)
+	}
+	return api
+}
+
+// An APIDiff lists the names of the declarations added, removed and
+// changed between two versions of the API of a package.
+type APIDiff struct {
+	Added, Removed, Changed []string
+}
+
+// Diff returns the changes from the API old to api, sorted by name.
+func (api API) Diff(old API) APIDiff {
+	var d APIDiff
+	for name, digest := range api {
+		switch prev, ok := old[name]; {
+		case !ok:
+			d.Added = append(d.Added, name)
+		case prev != digest:
+			d.Changed = append(d.Changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := api[name]; !ok {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d
+}
+
+// Empty reports whether the API did not change.
+func (d APIDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
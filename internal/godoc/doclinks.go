@@ -0,0 +1,225 @@
+package godoc
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/doc/comment"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// docLinkLike matches bracketed text which looks like a doc link, such as
+// [Name], [T.M], [*T] or [encoding/json.Decoder].
+var docLinkLike = regexp.MustCompile(`\[\*?[\pL_][\pL\pN_]*(?:[./][\pL_][\pL\pN_]*)*\]`)
+
+// FindUnresolvedLinks returns the locations of bracketed text in the plain
+// text s of a parsed doc comment which looks like doc links to exported
+// identifiers. Since the parser left them as plain text, they could not be
+// resolved. Links to packages and unexported names are ambiguous with
+// ordinary bracketed text, and are not reported.
+func FindUnresolvedLinks(s string) [][]int {
+	var locs [][]int
+	for _, loc := range docLinkLike.FindAllStringIndex(s, -1) {
+		if isLinkBoundary(s, loc[0], loc[1]) && hasExported(s[loc[0]+1:loc[1]-1]) {
+			locs = append(locs, loc)
+		}
+	}
+	return locs
+}
+
+// isLinkBoundary reports whether the text between start and end is
+// delimited as go/doc/comment requires of doc links: not preceded or
+// followed by a letter or digit.
+func isLinkBoundary(text string, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:start])
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		r, _ := utf8.DecodeRuneInString(text[end:])
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasExported reports whether the doc link text names an exported
+// identifier.
+func hasExported(link string) bool {
+	link = strings.TrimPrefix(link, "*")
+	if i := strings.LastIndexByte(link, '/'); i >= 0 {
+		link = link[i+1:]
+	}
+	for _, name := range strings.Split(link, ".") {
+		if token.IsExported(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkText returns the text of a doc link as written, without brackets.
+func LinkText(l *comment.DocLink) string {
+	var b strings.Builder
+	for _, t := range l.Text {
+		if p, ok := t.(comment.Plain); ok {
+			b.WriteString(string(p))
+		}
+	}
+	return b.String()
+}
+
+// DocLinks returns the doc links in the doc comment, and the text of the
+// doc links which could not be resolved, without brackets.
+func DocLinks(d *comment.Doc) (links []*comment.DocLink, unresolved []string) {
+	var walkText func(texts []comment.Text)
+	walkText = func(texts []comment.Text) {
+		for _, t := range texts {
+			switch t := t.(type) {
+			case comment.Plain:
+				for _, loc := range FindUnresolvedLinks(string(t)) {
+					unresolved = append(unresolved, string(t)[loc[0]+1:loc[1]-1])
+				}
+			case *comment.DocLink:
+				links = append(links, t)
+			case *comment.Link:
+				walkText(t.Text)
+			}
+		}
+	}
+	var walk func(blocks []comment.Block)
+	walk = func(blocks []comment.Block) {
+		for _, b := range blocks {
+			switch b := b.(type) {
+			case *comment.Paragraph:
+				walkText(b.Text)
+			case *comment.Heading:
+				walkText(b.Text)
+			case *comment.List:
+				for _, item := range b.Items {
+					walk(item.Content)
+				}
+			}
+		}
+	}
+	walk(d.Content)
+	return links, unresolved
+}
+
+// CheckDocLinks checks the doc links in the documentation of a package
+// built from src. Links to other packages are resolved with the Importer,
+// which must have checked the packages of the module with [Importer.Check].
+// It returns warnings for links which could not be resolved or which refer
+// to symbols missing from their package, and the import paths of linked
+// packages which are not available.
+func (imp *Importer) CheckDocLinks(src *Package, dpkg *doc.Package) ([]Warning, []string) {
+	if src == nil || dpkg == nil {
+		return nil, nil
+	}
+	parser := dpkg.Parser()
+	var warnings []Warning
+	var missing []string
+	seen := make(map[string]bool)
+	check := func(name, text string, pos token.Pos) {
+		if text == "" {
+			return
+		}
+		warn := func(link, msg string) {
+			p := src.Fset.Position(pos)
+			warnings = append(warnings, Warning{
+				File:    p.Filename,
+				Line:    p.Line,
+				Name:    name,
+				Link:    link,
+				Message: msg,
+			})
+		}
+		links, unresolved := DocLinks(parser.Parse(text))
+		for _, link := range unresolved {
+			warn(link, "doc link ["+link+"] could not be resolved")
+		}
+		for _, l := range links {
+			if l.ImportPath == "" || l.ImportPath == dpkg.ImportPath {
+				// Resolved against the declarations of the package
+				continue
+			}
+			// Prefer packages checked by Check, whose sources may since
+			// have been modified by go/doc
+			pkg, ok := imp.checked[l.ImportPath]
+			if !ok {
+				pkg, _ = imp.Import(l.ImportPath)
+			}
+			if pkg == nil {
+				if !seen[l.ImportPath] {
+					seen[l.ImportPath] = true
+					missing = append(missing, l.ImportPath)
+				}
+				continue
+			}
+			if l.Name != "" && !hasSymbol(pkg, l.Recv, l.Name) {
+				text := LinkText(l)
+				warn(text, "doc link ["+text+"] refers to a symbol not declared by package "+l.ImportPath)
+			}
+		}
+	}
+
+	check(dpkg.Name, dpkg.Doc, token.NoPos)
+	values := func(values []*doc.Value) {
+		for _, v := range values {
+			if len(v.Names) > 0 {
+				check(v.Names[0], v.Doc, v.Decl.Pos())
+			}
+		}
+	}
+	funcs := func(funcs []*doc.Func, recv string) {
+		for _, f := range funcs {
+			if f.Level > 0 {
+				continue
+			}
+			name := f.Name
+			if recv != "" {
+				name = recv + "." + f.Name
+			}
+			check(name, f.Doc, f.Decl.Name.Pos())
+		}
+	}
+	values(dpkg.Consts)
+	values(dpkg.Vars)
+	funcs(dpkg.Funcs, "")
+	for _, t := range dpkg.Types {
+		pos := t.Decl.Pos()
+		for _, spec := range t.Decl.Specs {
+			if ts := spec.(*ast.TypeSpec); ts.Name.Name == t.Name {
+				pos = ts.Name.Pos()
+			}
+		}
+		check(t.Name, t.Doc, pos)
+		values(t.Consts)
+		values(t.Vars)
+		funcs(t.Funcs, "")
+		funcs(t.Methods, t.Name)
+	}
+	return warnings, missing
+}
+
+// hasSymbol reports whether the package declares the exported symbol name,
+// or the method or field name of the type recv if recv is not empty.
+func hasSymbol(pkg *types.Package, recv, name string) bool {
+	if recv == "" {
+		obj := pkg.Scope().Lookup(name)
+		return obj != nil && obj.Exported()
+	}
+	tn, ok := pkg.Scope().Lookup(recv).(*types.TypeName)
+	if !ok {
+		return false
+	}
+	obj, _, _ := types.LookupFieldOrMethod(tn.Type(), true, pkg, name)
+	return obj != nil && obj.Exported()
+}
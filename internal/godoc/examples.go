@@ -0,0 +1,126 @@
+package godoc
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// A Warning is a problem found in the documentation of a package.
+type Warning struct {
+	File    string `json:"file"`           // source file name
+	Line    int    `json:"line,omitempty"` // source line
+	Name    string `json:"name"`           // name of the declaration
+	Link    string `json:"link,omitempty"` // text of a broken doc link
+	Message string `json:"message"`
+}
+
+var (
+	// outputPrefix matches the output comments recognized by go/doc.
+	outputPrefix = regexp.MustCompile(`(?i)^[[:space:]]*(unordered )?output:`)
+	// outputLike matches comments which look like malformed output
+	// comments, such as "Output" on a line of its own, "Outputs:" or
+	// "Output (unordered):".
+	outputLike = regexp.MustCompile(`(?i)^[[:space:]]*(unordered[[:space:]]+)?outputs?[ \t]*([^\w\s]|(?m:$))`)
+)
+
+// CheckExamples checks the examples in the test files of the package and
+// returns warnings for examples which go/doc or go test ignore or
+// misinterpret: examples whose names do not match a declaration of the
+// package, examples with parameters or results, and malformed output
+// comments. The examples attached to the declarations in dpkg, the
+// documentation built from src, are those recognized by go/doc.
+func CheckExamples(src *Package, dpkg *doc.Package) []Warning {
+	if src == nil || dpkg == nil {
+		return nil
+	}
+	attached := attachedExamples(dpkg)
+	var warnings []Warning
+	for _, f := range src.Files {
+		if !strings.HasSuffix(f.Name, "_test.go") {
+			continue
+		}
+		for _, d := range f.AST.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "Example") {
+				continue
+			}
+			warn := func(pos token.Pos, msg string) {
+				warnings = append(warnings, Warning{
+					File:    f.Name,
+					Line:    src.Fset.Position(pos).Line,
+					Name:    fn.Name.Name,
+					Message: msg,
+				})
+			}
+			switch {
+			case fn.Type.Params.NumFields() > 0 || fn.Type.Results.NumFields() > 0 ||
+				fn.Type.TypeParams.NumFields() > 0:
+				warn(fn.Pos(), "example has parameters, results or type parameters and is ignored")
+			case !attached[fn.Name.Name]:
+				warn(fn.Pos(), "example name does not match an exported function, type or method "+
+					"followed by an optional lower-case suffix; the example is ignored")
+			}
+			if fn.Body != nil {
+				checkOutput(f.AST, fn.Body, warn)
+			}
+		}
+	}
+	return warnings
+}
+
+// attachedExamples returns the names of the example functions attached to
+// the package documentation.
+func attachedExamples(pkg *doc.Package) map[string]bool {
+	names := make(map[string]bool)
+	add := func(examples []*doc.Example) {
+		for _, ex := range examples {
+			names["Example"+ex.Name] = true
+		}
+	}
+	add(pkg.Examples)
+	for _, f := range pkg.Funcs {
+		add(f.Examples)
+	}
+	for _, t := range pkg.Types {
+		add(t.Examples)
+		for _, f := range t.Funcs {
+			add(f.Examples)
+		}
+		for _, m := range t.Methods {
+			add(m.Examples)
+		}
+	}
+	return names
+}
+
+// checkOutput checks the output comment of an example. go/doc only
+// recognizes an output comment which is the last comment in the body of the
+// example.
+func checkOutput(file *ast.File, body *ast.BlockStmt, warn func(token.Pos, string)) {
+	var comments []*ast.CommentGroup
+	for _, cg := range file.Comments {
+		if body.Lbrace < cg.Pos() && cg.End() < body.Rbrace {
+			comments = append(comments, cg)
+		}
+	}
+	for i, cg := range comments {
+		text := cg.Text()
+		switch {
+		case outputPrefix.MatchString(text):
+			if i != len(comments)-1 {
+				warn(cg.Pos(), "output comment is not the last comment in the example and is ignored")
+				continue
+			}
+			prefix, output, _ := strings.Cut(text, ":")
+			unordered := strings.Contains(strings.ToLower(prefix), "unordered")
+			if unordered && !strings.Contains(strings.TrimSpace(output), "\n") {
+				warn(cg.Pos(), "unordered output has fewer than two lines; use an ordinary output comment")
+			}
+		case outputLike.MatchString(text):
+			warn(cg.Pos(), `malformed output comment; it must begin with "Output:" or "Unordered output:"`)
+		}
+	}
+}
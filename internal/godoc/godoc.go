@@ -14,6 +14,8 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // A Package contains package-level information needed to render Go documentation.
@@ -60,30 +62,38 @@ func (p *Package) AddFile(f *ast.File, removeNodes bool) {
 }
 
 // removeUnusedASTNodes removes parts of the AST not needed for documentation.
-// It doesn't remove unexported consts, vars or types, although it probably could.
+// Unexported declarations are kept, so that they can be shown on request.
+// Packages encoded before unexported functions and methods were kept lack
+// them.
 func removeUnusedASTNodes(pf *ast.File) {
-	var decls []ast.Decl
 	for _, d := range pf.Decls {
 		if f, ok := d.(*ast.FuncDecl); ok {
-			// Remove all unexported functions and function bodies.
-			if f.Name == nil || !ast.IsExported(f.Name.Name) {
-				continue
-			}
 			// Remove the function body, unless it's an example.
 			// The doc contains example bodies.
-			if !strings.HasPrefix(f.Name.Name, "Example") {
+			if f.Name == nil || !strings.HasPrefix(f.Name.Name, "Example") {
 				f.Body = nil
 			}
 		}
-		decls = append(decls, d)
 	}
 	// Don't remove pf.Comments; they may contain Notes.
-	pf.Decls = decls
 }
 
-// buildDoc builds documentation for the given package.
+// IsDeprecated reports whether the given doc comment text marks its
+// declaration as deprecated. Following the Go convention, a declaration is
+// deprecated if a paragraph of its doc comment begins with "Deprecated: ".
+func IsDeprecated(text string) bool {
+	for _, para := range strings.Split(text, "\n\n") {
+		if strings.HasPrefix(strings.TrimSpace(para), "Deprecated: ") {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildDoc builds documentation for the given package. If allDecls is true,
+// unexported declarations are included.
 // If src is nil, it returns an empty [doc.Package].
-func BuildDoc(src *Package, importPath string) (*doc.Package, error) {
+func BuildDoc(src *Package, importPath string, allDecls bool) (*doc.Package, error) {
 	if src == nil {
 		// No Go source files
 		return &doc.Package{
@@ -94,8 +104,9 @@ func BuildDoc(src *Package, importPath string) (*doc.Package, error) {
 	for _, f := range src.Files {
 		files = append(files, f.AST)
 	}
-	mode := doc.Mode(0)
-	if importPath == "builtin" {
+	// Include methods promoted from embedded types
+	mode := doc.AllMethods
+	if allDecls || importPath == "builtin" {
 		mode |= doc.AllDecls
 	}
 	pkg, err := doc.NewFromFiles(src.Fset, files, importPath, mode)
@@ -115,6 +126,200 @@ func BuildDoc(src *Package, importPath string) (*doc.Package, error) {
 	return pkg, nil
 }
 
+// BuildTestDoc builds documentation for the exported identifiers declared in
+// the test files of the given package, such as helpers in export_test.go.
+// Tests, benchmarks, fuzz targets and examples are omitted. It returns the
+// documentation of each package declared by test files which declares any
+// such identifiers, the package itself before its external test package.
+//
+// Methods declared in test files on types declared in other files are
+// documented under types without declaration or doc comment.
+func BuildTestDoc(src *Package, importPath string) []*doc.Package {
+	if src == nil {
+		return nil
+	}
+	pkgs := make(map[string]*ast.Package)
+	var names []string
+	var others []*File
+	for _, f := range src.Files {
+		if !strings.HasSuffix(f.Name, "_test.go") {
+			others = append(others, f)
+			continue
+		}
+		name := f.AST.Name.Name
+		if pkgs[name] == nil {
+			pkgs[name] = &ast.Package{Name: name, Files: make(map[string]*ast.File)}
+			names = append(names, name)
+		}
+		pkgs[name].Files[f.Name] = f.AST
+	}
+	// Test files of the package may declare methods on types declared in
+	// its other files
+	for _, f := range others {
+		if pkg := pkgs[f.AST.Name.Name]; pkg != nil {
+			pkg.Files[f.Name] = f.AST
+		}
+	}
+	inTestFile := func(pos token.Pos) bool {
+		return strings.HasSuffix(src.Fset.Position(pos).Filename, "_test.go")
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ti, tj := strings.HasSuffix(names[i], "_test"), strings.HasSuffix(names[j], "_test")
+		if ti != tj {
+			return tj
+		}
+		return names[i] < names[j]
+	})
+
+	var result []*doc.Package
+	for _, name := range names {
+		// The files are shared with the package documentation and the
+		// example files, so they must not be modified. Without AllDecls,
+		// doc.New would remove the unexported declarations from them.
+		pkg := doc.New(pkgs[name], importPath, doc.AllDecls|doc.PreserveAST)
+		filterTestDecls(pkg, inTestFile)
+		trimTestDecls(pkg)
+		if len(pkg.Consts) > 0 || len(pkg.Vars) > 0 || len(pkg.Funcs) > 0 || len(pkg.Types) > 0 {
+			result = append(result, pkg)
+		}
+	}
+	return result
+}
+
+// ExampleFiles returns the test files of the given package which declare
+// examples, so that the examples can be shown with the imports and helper
+// declarations of their files.
+func ExampleFiles(src *Package) []*File {
+	if src == nil {
+		return nil
+	}
+	var files []*File
+	for _, f := range src.Files {
+		if !strings.HasSuffix(f.Name, "_test.go") {
+			continue
+		}
+		for _, d := range f.AST.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if ok && fn.Recv == nil && strings.HasPrefix(fn.Name.Name, "Example") && isTestFunc(fn.Name.Name) {
+				files = append(files, f)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// filterTestDecls removes the declarations of the package documentation
+// which are unexported, tests or not in test files. Types declared outside
+// of test files are kept without declaration if test files declare any of
+// their members.
+func filterTestDecls(pkg *doc.Package, inTestFile func(token.Pos) bool) {
+	values := func(values []*doc.Value) []*doc.Value {
+		var result []*doc.Value
+		for _, v := range values {
+			if inTestFile(v.Decl.Pos()) && anyExported(v.Names) {
+				result = append(result, v)
+			}
+		}
+		return result
+	}
+	funcs := func(funcs []*doc.Func) []*doc.Func {
+		var result []*doc.Func
+		for _, f := range funcs {
+			if inTestFile(f.Decl.Pos()) && ast.IsExported(f.Name) && !isTestFunc(f.Name) {
+				result = append(result, f)
+			}
+		}
+		return result
+	}
+	pkg.Consts = values(pkg.Consts)
+	pkg.Vars = values(pkg.Vars)
+	pkg.Funcs = funcs(pkg.Funcs)
+	var types []*doc.Type
+	for _, t := range pkg.Types {
+		if !ast.IsExported(t.Name) {
+			continue
+		}
+		t.Consts = values(t.Consts)
+		t.Vars = values(t.Vars)
+		t.Funcs = funcs(t.Funcs)
+		t.Methods = funcs(t.Methods)
+		if !inTestFile(t.Decl.Pos()) {
+			if len(t.Consts) == 0 && len(t.Vars) == 0 && len(t.Funcs) == 0 && len(t.Methods) == 0 {
+				continue
+			}
+			t.Decl = nil
+			t.Doc = ""
+		}
+		types = append(types, t)
+	}
+	pkg.Types = types
+}
+
+// trimTestDecls replaces the declarations of the package documentation with
+// copies without doc comments or function bodies, as doc.New would have
+// done if the AST were not preserved.
+func trimTestDecls(pkg *doc.Package) {
+	values := func(values []*doc.Value) {
+		for _, v := range values {
+			v.Decl = trimGenDecl(v.Decl)
+		}
+	}
+	funcs := func(funcs []*doc.Func) {
+		for _, f := range funcs {
+			decl := *f.Decl
+			decl.Doc = nil
+			decl.Body = nil
+			f.Decl = &decl
+		}
+	}
+	values(pkg.Consts)
+	values(pkg.Vars)
+	funcs(pkg.Funcs)
+	for _, t := range pkg.Types {
+		if t.Decl != nil {
+			t.Decl = trimGenDecl(t.Decl)
+		}
+		values(t.Consts)
+		values(t.Vars)
+		funcs(t.Funcs)
+		funcs(t.Methods)
+	}
+}
+
+func anyExported(names []string) bool {
+	for _, name := range names {
+		if ast.IsExported(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func trimGenDecl(decl *ast.GenDecl) *ast.GenDecl {
+	d := *decl
+	d.Doc = nil
+	return &d
+}
+
+// isTestFunc reports whether the function name is that of a test,
+// benchmark, fuzz target or example.
+func isTestFunc(name string) bool {
+	for _, prefix := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if len(name) == len(prefix) {
+			return true
+		}
+		r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+		if !unicode.IsLower(r) {
+			return true
+		}
+	}
+	return false
+}
+
 // ParseFiles parses each abstract syntax tree from the named files in fsys.
 // The returned package contains...
 func ParseFiles(fsys fs.FS, names []string, isBuiltin bool) (*Package, error) {
@@ -6,12 +6,16 @@ package godoc
 
 import (
 	"bytes"
+	"go/ast"
 	"go/format"
 	"go/parser"
 	"go/token"
+	"strconv"
 	"testing"
+	"testing/fstest"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestRemoveUnusedASTNodes(t *testing.T) {
@@ -81,11 +85,13 @@ type t int
 func Exp()
 
 // unexp is not exported, but the comment is preserved for notes.
+func unexp()
 
 // M is exported.
 func (t T) M() int
 
 // m isn't, but the comment is preserved for notes.
+func (T) m()
 
 // U is an exported method of an unexported type.
 // Its doc is not shown, unless t is embedded
@@ -110,3 +116,626 @@ func (t) U()
 		t.Errorf("mismatch (-want, +got):\n%s", diff)
 	}
 }
+
+func TestRemoveUnusedASTNodesUnexported(t *testing.T) {
+	const file = `package p
+
+type t int
+
+func unexp(x int) int {
+	return x + 1
+}
+
+func (t) method() {
+	println()
+}
+
+func init() {
+	unexp(1)
+}
+
+func Example() {
+	unexp(2)
+}
+`
+	const want = `package p
+
+type t int
+
+func unexp(x int) int
+
+func (t) method()
+
+func init()
+
+func Example() {
+	unexp(2)
+}
+`
+
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, "tst.go", file, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removeUnusedASTNodes(astFile)
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, astFile); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestIsDeprecated(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want bool
+	}{
+		{"", false},
+		{"Deprecated: use Bar instead.\n", true},
+		{"Foo does things.\n\nDeprecated: use Bar instead.\n", true},
+		{"Foo does things.\nDeprecated: not a separate paragraph.\n", false},
+		{"Foo is not Deprecated: at all.\n", false},
+		{"Deprecated:no space.\n", false},
+	} {
+		if got := IsDeprecated(test.text); got != test.want {
+			t.Errorf("IsDeprecated(%q) = %t, want %t", test.text, got, test.want)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dep/dep.go": {Data: []byte(`package dep
+
+type Base struct{ Field int }
+
+func (Base) Method() {}
+
+type hidden int
+`)},
+		"p/p.go": {Data: []byte(`package p
+
+import "example.com/dep"
+
+type T[E any] struct {
+	dep.Base
+	Elem E
+}
+
+func F(t T[int]) error { return nil }
+`)},
+		"p/example_test.go": {Data: []byte(`package p_test
+
+import (
+	"example.com/dep"
+	"example.com/p"
+)
+
+func ExampleF() {
+	var b dep.Base
+	b.Method()
+	_ = b.Field
+	p.F(p.T[int]{})
+}
+`)},
+	}
+	srcs := map[string]*Package{}
+	for importPath, names := range map[string][]string{
+		"example.com/dep": {"dep/dep.go"},
+		"example.com/p":   {"p/p.go", "p/example_test.go"},
+	} {
+		pkg, err := ParseFiles(fsys, names, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs[importPath] = pkg
+	}
+	imp := NewImporter(func(importPath string) (*Package, error) {
+		return srcs[importPath], nil
+	})
+	src := srcs["example.com/p"]
+	links := imp.Check("example.com/p", src).Links
+
+	got := map[string]Link{}
+	for _, f := range src.Files {
+		ast.Inspect(f.AST, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				if link, ok := links.Lookup(src.Fset, id); ok {
+					got[f.Name+":"+id.Name+"@"+strconv.Itoa(src.Fset.Position(id.Pos()).Line)] = link
+				}
+			}
+			return true
+		})
+	}
+	want := map[string]Link{
+		"p.go:dep@6":                {Path: "example.com/dep"},
+		"p.go:Base@6":               {Path: "example.com/dep", Fragment: "Base"},
+		"p.go:E@7":                  {Path: "example.com/p", File: "p.go", Line: 5},
+		"p.go:any@5":                {Path: "builtin", Fragment: "any"},
+		"p.go:T@10":                 {Path: "example.com/p", Fragment: "T"},
+		"p.go:int@10":               {Path: "builtin", Fragment: "int"},
+		"p.go:error@10":             {Path: "builtin", Fragment: "error"},
+		"example_test.go:dep@9":     {Path: "example.com/dep"},
+		"example_test.go:Base@9":    {Path: "example.com/dep", Fragment: "Base"},
+		"example_test.go:b@10":      {Path: "example.com/p", File: "example_test.go", Line: 9},
+		"example_test.go:Method@10": {Path: "example.com/dep", Fragment: "Base.Method"},
+		"example_test.go:b@11":      {Path: "example.com/p", File: "example_test.go", Line: 9},
+		"example_test.go:Field@11":  {Path: "example.com/dep", Fragment: "Base.Field"},
+		"example_test.go:p@12":      {Path: "example.com/p"},
+		"example_test.go:F@12":      {Path: "example.com/p", Fragment: "F"},
+		"example_test.go:T@12":      {Path: "example.com/p", Fragment: "T"},
+		"example_test.go:int@12":    {Path: "builtin", Fragment: "int"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestPromoted(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dep/dep.go": {Data: []byte(`package dep
+
+type Base struct{ Field int }
+
+func (Base) Method() {}
+
+func (*Base) PtrMethod() {}
+
+type Reader interface{ Read() }
+`)},
+		"p/p.go": {Data: []byte(`package p
+
+import "example.com/dep"
+
+type T struct {
+	dep.Base
+	local
+}
+
+type local struct{ Count int }
+
+func (local) Local() {}
+
+type I interface {
+	dep.Reader
+	Close()
+}
+`)},
+	}
+	srcs := map[string]*Package{}
+	for importPath, name := range map[string]string{
+		"example.com/dep": "dep/dep.go",
+		"example.com/p":   "p/p.go",
+	} {
+		pkg, err := ParseFiles(fsys, []string{name}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs[importPath] = pkg
+	}
+	imp := NewImporter(func(importPath string) (*Package, error) {
+		return srcs[importPath], nil
+	})
+	got := imp.Check("example.com/p", srcs["example.com/p"]).Promoted
+	want := Promoted{
+		"I": {
+			{Name: "Read", Method: true, Recv: "I", Decl: "func (I) Read()", Origin: "dep.Reader",
+				Link: Link{Path: "example.com/dep", Fragment: "Reader.Read"}},
+		},
+		"T": {
+			{Name: "Count", Decl: "Count int", Origin: "local",
+				Link: Link{Path: "example.com/p", File: "p.go", Line: 10}},
+			{Name: "Field", Decl: "Field int", Origin: "dep.Base",
+				Link: Link{Path: "example.com/dep", Fragment: "Base.Field"}},
+			{Name: "Method", Method: true, Recv: "T", Decl: "func (T) Method()", Origin: "dep.Base",
+				Link: Link{Path: "example.com/dep", Fragment: "Base.Method"}},
+			{Name: "PtrMethod", Method: true, Recv: "*T", Decl: "func (*T) PtrMethod()", Origin: "dep.Base",
+				Link: Link{Path: "example.com/dep", Fragment: "Base.PtrMethod"}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestImplements(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dep/dep.go": {Data: []byte(`package dep
+
+type Reader interface{ Read() }
+
+type Empty interface{}
+`)},
+		"p/p.go": {Data: []byte(`package p
+
+import "example.com/dep"
+
+type Closer interface{ Close() }
+
+type T struct{}
+
+func (T) Read()          {}
+func (*T) Close()        {}
+func (T) Error() string  { return "" }
+
+type G[E any] struct{}
+
+func (G[E]) Read() {}
+
+var _ dep.Reader
+`)},
+	}
+	srcs := map[string]*Package{}
+	for importPath, name := range map[string]string{
+		"example.com/dep": "dep/dep.go",
+		"example.com/p":   "p/p.go",
+	} {
+		pkg, err := ParseFiles(fsys, []string{name}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs[importPath] = pkg
+	}
+	imp := NewImporter(func(importPath string) (*Package, error) {
+		return srcs[importPath], nil
+	})
+	imp.Check("example.com/p", srcs["example.com/p"])
+	got := imp.Implements("example.com/p", []string{"example.com/dep", "example.com/p"})
+	want := []Implementation{
+		{Type: "T", IfacePath: "builtin", IfaceName: "error"},
+		{Type: "T", IfacePath: "example.com/dep", IfaceName: "Reader"},
+		{Type: "T", Pointer: true, IfacePath: "example.com/p", IfaceName: "Closer"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestBuildTestDoc(t *testing.T) {
+	fsys := fstest.MapFS{
+		"p.go": {Data: []byte(`package p
+
+func F() {}
+
+type T struct{}
+
+func (T) M() {}
+
+type U struct{}
+`)},
+		"export_test.go": {Data: []byte(`package p
+
+// Helper is a test helper.
+func Helper() int { return 0 }
+
+// Reset resets t for tests.
+func (t *T) Reset() {}
+
+func TestF(t *testing.T) {}
+
+func Testify() {}
+`)},
+		"x_test.go": {Data: []byte(`package p_test
+
+type Fake struct{}
+
+type fake struct{}
+
+func helper() {}
+
+func ExampleF() {}
+
+func BenchmarkF(b *testing.B) {}
+`)},
+	}
+	src, err := ParseFiles(fsys, []string{"p.go", "export_test.go", "x_test.go"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for _, pkg := range BuildTestDoc(src, "example.com/p") {
+		var names []string
+		for _, f := range pkg.Funcs {
+			names = append(names, f.Name)
+			if f.Decl.Body != nil || f.Decl.Doc != nil {
+				t.Errorf("%s: declaration not trimmed", f.Name)
+			}
+		}
+		for _, typ := range pkg.Types {
+			names = append(names, typ.Name)
+			for _, m := range typ.Methods {
+				names = append(names, typ.Name+"."+m.Name)
+			}
+			if typ.Name == "T" && typ.Decl != nil {
+				t.Error("T: declaration outside of test files not removed")
+			}
+		}
+		got[pkg.Name] = names
+	}
+	want := map[string][]string{
+		"p":      {"Helper", "Testify", "T", "T.Reset"},
+		"p_test": {"Fake"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+	// The AST of the test files must be preserved for examples
+	for _, f := range src.Files {
+		if f.Name == "export_test.go" && f.AST.Decls[0].(*ast.FuncDecl).Body == nil {
+			t.Error("test file AST was modified")
+		}
+		if f.Name == "x_test.go" && len(f.AST.Decls) != 5 {
+			t.Error("unexported declarations were removed from test file AST")
+		}
+	}
+}
+
+func TestExampleFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"p.go": {Data: []byte(`package p
+
+func ExampleNotATest() {}
+`)},
+		"p_test.go": {Data: []byte(`package p
+
+func TestF(t *testing.T) {}
+
+func Examples() {}
+`)},
+		"example_test.go": {Data: []byte(`package p_test
+
+import "fmt"
+
+func helper() string { return "hello" }
+
+func Example() {
+	fmt.Println(helper())
+}
+`)},
+	}
+	src, err := ParseFiles(fsys, []string{"p.go", "p_test.go", "example_test.go"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range ExampleFiles(src) {
+		got = append(got, f.Name)
+		// The helper declarations are kept
+		if len(f.AST.Imports) != 1 || len(f.AST.Decls) != 3 {
+			t.Errorf("%s: declarations were removed", f.Name)
+		}
+	}
+	if diff := cmp.Diff([]string{"example_test.go"}, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestCheckExamples(t *testing.T) {
+	fsys := fstest.MapFS{
+		"p.go": {Data: []byte(`package p
+
+type T struct{}
+
+func NewT() *T { return nil }
+
+func (T) M() {}
+`)},
+		"example_test.go": {Data: []byte(`package p_test
+
+import "fmt"
+
+func Example() {
+	fmt.Println("a")
+	fmt.Println("b")
+	// Unordered output:
+	// a
+	// b
+}
+
+func ExampleNewT() {
+	// output: ok
+}
+
+func ExampleT_M_suffix() {
+	fmt.Println("ok")
+	// Output: ok
+}
+
+func ExampleMissing() {}
+
+func ExampleT_Missing() {}
+
+func ExampleT_Bad() {}
+
+func ExampleT_M_Suffix() {}
+
+func ExampleT_args(int) {}
+
+func ExampleT_unordered() {
+	fmt.Println("a")
+	// Unordered output: a
+}
+
+func ExampleT_malformed() {
+	fmt.Println("a")
+	// Output
+	// a
+}
+
+func ExampleT_misplaced() {
+	// Output: a
+	fmt.Println("a")
+	// Done.
+}
+
+func ExampleT_prose() {
+	// output the value
+	fmt.Println("a")
+}
+`)},
+	}
+	src, err := ParseFiles(fsys, []string{"p.go", "example_test.go"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dpkg, err := BuildDoc(src, "example.com/p", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, w := range CheckExamples(src, dpkg) {
+		got = append(got, w.File+":"+strconv.Itoa(w.Line)+" "+w.Name)
+	}
+	want := []string{
+		"example_test.go:22 ExampleMissing",
+		"example_test.go:24 ExampleT_Missing",
+		"example_test.go:26 ExampleT_Bad",
+		"example_test.go:28 ExampleT_M_Suffix",
+		"example_test.go:30 ExampleT_args",
+		"example_test.go:34 ExampleT_unordered",
+		"example_test.go:39 ExampleT_malformed",
+		"example_test.go:44 ExampleT_misplaced",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestCheckDocLinks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dep/dep.go": {Data: []byte(`package dep
+
+type Base struct{ Field int }
+
+func (Base) Method() {}
+
+func F() {}
+`)},
+		"p/p.go": {Data: []byte(`// Package p uses [dep.Base] and [missing.Thing].
+package p
+
+import (
+	"example.com/dep"
+	"example.com/missing"
+)
+
+// T embeds [dep.Base], with [dep.Base.Method] and [dep.Base.Field], but
+// not [dep.Base.Nope], [dep.G] or [Nope]. Indexing like s[T] and [lower]
+// text are not links.
+type T struct{ dep.Base }
+
+// F calls [dep.F] and [T.Method].
+func F() { dep.F(); missing.Thing() }
+`)},
+	}
+	srcs := map[string]*Package{}
+	for importPath, name := range map[string]string{
+		"example.com/dep": "dep/dep.go",
+		"example.com/p":   "p/p.go",
+	} {
+		pkg, err := ParseFiles(fsys, []string{name}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs[importPath] = pkg
+	}
+	imp := NewImporter(func(importPath string) (*Package, error) {
+		return srcs[importPath], nil
+	})
+	src := srcs["example.com/p"]
+	imp.Check("example.com/p", src)
+	dpkg, err := BuildDoc(src, "example.com/p", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warnings, missing := imp.CheckDocLinks(src, dpkg)
+	var got []string
+	for _, w := range warnings {
+		got = append(got, w.File+":"+strconv.Itoa(w.Line)+" "+w.Name+" "+w.Link)
+	}
+	want := []string{
+		"p.go:12 T dep.Base.Nope",
+		"p.go:12 T dep.G",
+		"p.go:12 T Nope",
+		// go/doc does not resolve methods promoted from other packages
+		"p.go:15 F T.Method",
+	}
+	if diff := cmp.Diff(want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Errorf("warnings mismatch (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"example.com/missing"}, missing); diff != "" {
+		t.Errorf("missing mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	api := func(src string) API {
+		fsys := fstest.MapFS{"p/p.go": {Data: []byte(src)}}
+		pkg, err := ParseFiles(fsys, []string{"p/p.go"}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dpkg, err := BuildDoc(pkg, "example.com/p", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewAPI(pkg.Fset, dpkg)
+	}
+	old := api(`package p
+
+// F does something.
+func F(x int) {}
+
+func G() {}
+
+type T struct{ A int }
+
+func (T) M() {}
+
+const C = 1
+
+func unexported() {}
+`)
+	want := []string{"C", "F", "G", "T", "T.M"}
+	var names []string
+	for name := range old {
+		names = append(names, name)
+	}
+	if diff := cmp.Diff(want, names, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Errorf("NewAPI names mismatch (-want +got):\n%s", diff)
+	}
+
+	// Moving declarations and changing doc comments does not change them
+	cur := api(`package p
+
+type T struct{ A, B int }
+
+const C = 1
+
+// F does something else.
+func F(x int) {}
+
+func (T) M() {}
+
+func (T) N() {}
+
+func H() {}
+`)
+	got := cur.Diff(old)
+	wantDiff := APIDiff{
+		Added:   []string{"H", "T.N"},
+		Removed: []string{"G"},
+		Changed: []string{"T"},
+	}
+	if diff := cmp.Diff(wantDiff, got); diff != "" {
+		t.Errorf("Diff mismatch (-want +got):\n%s", diff)
+	}
+	if !cur.Diff(cur).Empty() {
+		t.Errorf("Diff of identical APIs = %+v, want empty", cur.Diff(cur))
+	}
+}
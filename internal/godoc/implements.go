@@ -0,0 +1,115 @@
+package godoc
+
+import (
+	"go/types"
+	"strings"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/stdlib"
+)
+
+// An Implementation records that a type implements an interface.
+type Implementation struct {
+	Type      string // name of the implementing type
+	Pointer   bool   // only a pointer to the type implements the interface
+	IfacePath string // import path of the interface's package
+	IfaceName string // name of the interface
+}
+
+// Implements returns the interfaces implemented by the exported types of the
+// checked package with the given import path. Interfaces are taken from the
+// universe scope, the packages with the given import paths, and the standard
+// library packages imported by the package.
+func (imp *Importer) Implements(importPath string, ifacePaths []string) []Implementation {
+	pkg := imp.checked[importPath]
+	if pkg == nil {
+		return nil
+	}
+	paths := append([]string(nil), ifacePaths...)
+	for _, p := range pkg.Imports() {
+		if stdlib.Contains(p.Path()) {
+			paths = append(paths, p.Path())
+		}
+	}
+
+	ifaces := []*types.TypeName{types.Universe.Lookup("error").(*types.TypeName)}
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		// Interfaces must be taken from the same packages as the types
+		// which refer to them.
+		p := pkg
+		if path != importPath {
+			var err error
+			if p, err = imp.Import(path); err != nil {
+				continue
+			}
+		}
+		for _, tn := range imp.exportedTypes(p) {
+			if isImplementable(tn) {
+				ifaces = append(ifaces, tn)
+			}
+		}
+	}
+
+	var impls []Implementation
+	for _, tn := range imp.exportedTypes(pkg) {
+		named, ok := tn.Type().(*types.Named)
+		if !ok || types.IsInterface(named) || named.TypeParams().Len() > 0 {
+			continue
+		}
+		ptr := types.NewPointer(named)
+		for _, iface := range ifaces {
+			it := iface.Type().Underlying().(*types.Interface)
+			impl := Implementation{
+				Type:      tn.Name(),
+				IfacePath: "builtin",
+				IfaceName: iface.Name(),
+			}
+			if iface.Pkg() != nil {
+				impl.IfacePath = iface.Pkg().Path()
+			}
+			switch {
+			case types.Implements(named, it):
+			case types.Implements(ptr, it):
+				impl.Pointer = true
+			default:
+				continue
+			}
+			impls = append(impls, impl)
+		}
+	}
+	return impls
+}
+
+// isImplementable reports whether the type is a non-empty, non-generic
+// interface which types may implement.
+func isImplementable(tn *types.TypeName) bool {
+	named, ok := tn.Type().(*types.Named)
+	if !ok || named.TypeParams().Len() > 0 {
+		return false
+	}
+	it, ok := named.Underlying().(*types.Interface)
+	return ok && it.NumMethods() > 0 && it.IsMethodSet()
+}
+
+// exportedTypes returns the exported types declared in the package, other
+// than aliases and types declared in test files.
+func (imp *Importer) exportedTypes(pkg *types.Package) []*types.TypeName {
+	fset := imp.fsets[pkg]
+	var tns []*types.TypeName
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || !tn.Exported() || tn.IsAlias() {
+			continue
+		}
+		if fset != nil && strings.HasSuffix(fset.Position(tn.Pos()).Filename, "_test.go") {
+			continue
+		}
+		tns = append(tns, tn)
+	}
+	return tns
+}
@@ -0,0 +1,259 @@
+package godoc
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// A Link is the definition of an object referred to by an identifier.
+// Objects shown in package documentation are identified by the anchor of
+// their documentation; other objects by the position of their definition.
+type Link struct {
+	Path     string `json:"path"`               // import path of the package
+	Fragment string `json:"fragment,omitempty"` // documentation anchor
+	File     string `json:"file,omitempty"`     // source file name
+	Line     int    `json:"line,omitempty"`     // source line
+}
+
+// Links maps the positions of identifiers to the definitions they refer to.
+// Positions are formatted as the file name and offset separated by a colon.
+type Links map[string]Link
+
+// Lookup returns the link for the given identifier.
+func (l Links) Lookup(fset *token.FileSet, id *ast.Ident) (Link, bool) {
+	if l == nil || fset == nil {
+		return Link{}, false
+	}
+	link, ok := l[posKey(fset.Position(id.Pos()))]
+	return link, ok
+}
+
+func posKey(pos token.Position) string {
+	return pos.Filename + ":" + strconv.Itoa(pos.Offset)
+}
+
+// An Importer type-checks packages in order to resolve links between them.
+// Imported packages are type-checked from the source returned by the load
+// function and cached for the lifetime of the Importer.
+type Importer struct {
+	load     func(importPath string) (*Package, error)
+	packages map[string]*types.Package
+	fsets    map[*types.Package]*token.FileSet
+	loading  map[string]bool
+	checked  map[string]*types.Package
+}
+
+// NewImporter returns a new Importer which loads package sources with the
+// given function. The function should return nil if the package is not
+// available.
+func NewImporter(load func(importPath string) (*Package, error)) *Importer {
+	return &Importer{
+		load:     load,
+		packages: make(map[string]*types.Package),
+		fsets:    make(map[*types.Package]*token.FileSet),
+		loading:  make(map[string]bool),
+		checked:  make(map[string]*types.Package),
+	}
+}
+
+var errImportCycle = errors.New("import cycle")
+
+// Import implements [types.Importer].
+func (imp *Importer) Import(importPath string) (*types.Package, error) {
+	if importPath == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, ok := imp.packages[importPath]; ok {
+		if pkg == nil {
+			return nil, errors.New("package " + importPath + " not available")
+		}
+		return pkg, nil
+	}
+	if imp.loading[importPath] {
+		return nil, errImportCycle
+	}
+	imp.loading[importPath] = true
+	defer delete(imp.loading, importPath)
+
+	src, err := imp.load(importPath)
+	if err != nil || src == nil {
+		imp.packages[importPath] = nil
+		if err == nil {
+			err = errors.New("package " + importPath + " not available")
+		}
+		return nil, err
+	}
+	var files []*ast.File
+	for _, f := range src.Files {
+		if !strings.HasSuffix(f.Name, "_test.go") {
+			files = append(files, f.AST)
+		}
+	}
+	pkg := imp.check(importPath, src.Fset, files, nil)
+	imp.packages[importPath] = pkg
+	return pkg, nil
+}
+
+// check type-checks the files as the package with the given import path.
+// Function bodies are only checked if info is not nil. Type errors are
+// ignored, so that as much of the package as possible is checked even if
+// some of its dependencies are not available.
+func (imp *Importer) check(importPath string, fset *token.FileSet, files []*ast.File, info *types.Info) *types.Package {
+	conf := types.Config{
+		Importer:         imp,
+		FakeImportC:      true,
+		IgnoreFuncBodies: info == nil,
+		Error:            func(error) {},
+	}
+	pkg, _ := conf.Check(importPath, fset, files, info)
+	imp.fsets[pkg] = fset
+	return pkg
+}
+
+// Info holds the results of analyzing a package.
+type Info struct {
+	Links    Links    // links of the identifiers in the package files
+	Promoted Promoted // members promoted from embedded types
+
+	// Problems found in the documentation of the package. Since they
+	// depend on its documentation, they are computed separately by
+	// [CheckExamples].
+	Warnings []Warning
+
+	// Interfaces implemented by the package's types. Since implementations
+	// depend on other packages, they are computed separately by
+	// [Importer.Implements].
+	Implements []Implementation
+
+	// The exported API of the package. Since it depends on its
+	// documentation, it is computed separately by [NewAPI].
+	API API
+}
+
+// Check type-checks the package, including its tests, and returns the links
+// of the identifiers in its files and the members promoted to its types.
+func (imp *Importer) Check(importPath string, src *Package) *Info {
+	if src == nil {
+		return nil
+	}
+	// Separate the files of external test packages
+	var files, xfiles []*ast.File
+	for _, f := range src.Files {
+		if strings.HasSuffix(f.AST.Name.Name, "_test") && strings.HasSuffix(f.Name, "_test.go") {
+			xfiles = append(xfiles, f.AST)
+		} else {
+			files = append(files, f.AST)
+		}
+	}
+
+	result := &Info{Links: make(Links)}
+	for path, files := range map[string][]*ast.File{
+		importPath:           files,
+		importPath + "_test": xfiles,
+	} {
+		if len(files) == 0 {
+			continue
+		}
+		info := &types.Info{Uses: make(map[*ast.Ident]types.Object)}
+		pkg := imp.check(path, src.Fset, files, info)
+		for id, obj := range info.Uses {
+			if link, ok := imp.link(obj); ok {
+				result.Links[posKey(src.Fset.Position(id.Pos()))] = link
+			}
+		}
+		if path == importPath {
+			imp.checked[importPath] = pkg
+			result.Promoted = imp.promoted(pkg)
+		}
+	}
+	return result
+}
+
+// link returns the link to the definition of the given object.
+func (imp *Importer) link(obj types.Object) (Link, bool) {
+	if pkgName, ok := obj.(*types.PkgName); ok {
+		return Link{Path: pkgName.Imported().Path()}, true
+	}
+	pkg := obj.Pkg()
+	if pkg == nil {
+		// Predeclared identifiers are documented by package builtin
+		return Link{Path: "builtin", Fragment: obj.Name()}, true
+	}
+	importPath := strings.TrimSuffix(pkg.Path(), "_test")
+
+	switch obj := obj.(type) {
+	case *types.Func:
+		obj = obj.Origin()
+		sig, _ := obj.Type().(*types.Signature)
+		if sig != nil && sig.Recv() != nil {
+			if named := recvNamed(sig.Recv().Type()); named != nil && obj.Exported() &&
+				isDocumented(named.Obj()) {
+				return Link{Path: importPath, Fragment: named.Obj().Name() + "." + obj.Name()}, true
+			}
+			return imp.sourceLink(importPath, obj)
+		}
+	case *types.Var:
+		obj = obj.Origin()
+		if obj.IsField() {
+			if owner := fieldOwner(obj); owner != nil && obj.Exported() {
+				return Link{Path: importPath, Fragment: owner.Name() + "." + obj.Name()}, true
+			}
+			return imp.sourceLink(importPath, obj)
+		}
+	}
+	if isDocumented(obj) {
+		return Link{Path: importPath, Fragment: obj.Name()}, true
+	}
+	return imp.sourceLink(importPath, obj)
+}
+
+// sourceLink returns a link to the source position of the object.
+func (imp *Importer) sourceLink(importPath string, obj types.Object) (Link, bool) {
+	fset := imp.fsets[obj.Pkg()]
+	if fset == nil || !obj.Pos().IsValid() {
+		return Link{}, false
+	}
+	pos := fset.Position(obj.Pos())
+	return Link{Path: importPath, File: path.Base(pos.Filename), Line: pos.Line}, true
+}
+
+// isDocumented reports whether the object is a package-level object shown
+// in package documentation.
+func isDocumented(obj types.Object) bool {
+	return obj.Exported() && obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope()
+}
+
+// recvNamed returns the named type of a method receiver.
+func recvNamed(t types.Type) *types.Named {
+	named, _ := deref(t).(*types.Named)
+	if named != nil {
+		named = named.Origin()
+	}
+	return named
+}
+
+// fieldOwner returns the documented type which declares the given field.
+func fieldOwner(field *types.Var) *types.TypeName {
+	scope := field.Pkg().Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || !tn.Exported() {
+			continue
+		}
+		st, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			if st.Field(i) == field {
+				return tn
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package godoc
+
+import (
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// A Member is a field or method of a type which is promoted from one of
+// the type's embedded fields.
+type Member struct {
+	Name   string `json:"name"`
+	Method bool   `json:"method,omitempty"`
+	Recv   string `json:"recv,omitempty"` // receiver of a method, e.g. "*T"
+	Decl   string `json:"decl"`           // declaration of the member on the type
+	Origin string `json:"origin"`         // embedded type providing the member
+	Link   Link   `json:"link"`           // definition of the member
+}
+
+// Promoted maps the names of types to their promoted members.
+type Promoted map[string][]Member
+
+// promoted returns the members promoted to the exported types of the
+// package. Methods promoted from concrete types declared in the same package
+// are omitted, since they are already listed by go/doc.
+func (imp *Importer) promoted(pkg *types.Package) Promoted {
+	promoted := make(Promoted)
+	for _, tn := range imp.exportedTypes(pkg) {
+		named, ok := tn.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+		var members []Member
+		switch t := named.Underlying().(type) {
+		case *types.Struct:
+			members = imp.structMembers(pkg, named)
+		case *types.Interface:
+			members = imp.interfaceMembers(pkg, named, t)
+		}
+		if len(members) > 0 {
+			sort.Slice(members, func(i, j int) bool {
+				return members[i].Name < members[j].Name
+			})
+			promoted[tn.Name()] = members
+		}
+	}
+	return promoted
+}
+
+// structMembers returns the members promoted to a struct type.
+func (imp *Importer) structMembers(pkg *types.Package, named *types.Named) []Member {
+	qual := qualifier(pkg)
+	var members []Member
+
+	values := types.NewMethodSet(named)
+	methods := types.NewMethodSet(types.NewPointer(named))
+	for i := 0; i < methods.Len(); i++ {
+		sel := methods.At(i)
+		fn, ok := sel.Obj().(*types.Func)
+		if !ok || len(sel.Index()) < 2 || !fn.Exported() {
+			continue
+		}
+		origin := embeddedType(named, sel.Index())
+		if isConcrete(pkg, origin) {
+			continue
+		}
+		recv := named.Obj().Name()
+		if values.Lookup(fn.Pkg(), fn.Name()) == nil {
+			recv = "*" + recv
+		}
+		members = append(members, imp.method(fn, recv, origin, qual))
+	}
+
+	for _, name := range embeddedFieldNames(named) {
+		obj, index, _ := types.LookupFieldOrMethod(named, false, pkg, name)
+		field, ok := obj.(*types.Var)
+		if !ok || !field.IsField() || len(index) < 2 {
+			// Ambiguous, shadowed, or not promoted
+			continue
+		}
+		link, _ := imp.link(field)
+		members = append(members, Member{
+			Name:   name,
+			Decl:   name + " " + types.TypeString(field.Type(), qual),
+			Origin: types.TypeString(embeddedType(named, index), qual),
+			Link:   link,
+		})
+	}
+	return members
+}
+
+// interfaceMembers returns the methods promoted to an interface type from
+// its embedded interfaces.
+func (imp *Importer) interfaceMembers(pkg *types.Package, named *types.Named, iface *types.Interface) []Member {
+	qual := qualifier(pkg)
+	explicit := make(map[string]bool)
+	for i := 0; i < iface.NumExplicitMethods(); i++ {
+		explicit[iface.ExplicitMethod(i).Name()] = true
+	}
+	var members []Member
+	for i := 0; i < iface.NumMethods(); i++ {
+		fn := iface.Method(i)
+		if explicit[fn.Name()] || !fn.Exported() {
+			continue
+		}
+		for j := 0; j < iface.NumEmbeddeds(); j++ {
+			embedded := iface.EmbeddedType(j)
+			e, ok := embedded.Underlying().(*types.Interface)
+			if !ok {
+				continue
+			}
+			if obj, _, _ := types.LookupFieldOrMethod(e, false, fn.Pkg(), fn.Name()); obj != nil {
+				members = append(members, imp.method(fn, named.Obj().Name(), embedded, qual))
+				break
+			}
+		}
+	}
+	return members
+}
+
+// method returns the member for a promoted method.
+func (imp *Importer) method(fn *types.Func, recv string, origin types.Type, qual types.Qualifier) Member {
+	sig := types.TypeString(fn.Type(), qual)
+	link, _ := imp.link(fn)
+	return Member{
+		Name:   fn.Name(),
+		Method: true,
+		Recv:   recv,
+		Decl:   "func (" + recv + ") " + fn.Name() + strings.TrimPrefix(sig, "func"),
+		Origin: types.TypeString(origin, qual),
+		Link:   link,
+	}
+}
+
+// qualifier returns a qualifier which refers to packages other than pkg by
+// their name.
+func qualifier(pkg *types.Package) types.Qualifier {
+	return func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+}
+
+// embeddedType returns the type of the embedded field through which a
+// field or method with the given index sequence is promoted.
+func embeddedType(named *types.Named, index []int) types.Type {
+	var t types.Type = named
+	for _, i := range index[:len(index)-1] {
+		st, ok := deref(t).Underlying().(*types.Struct)
+		if !ok {
+			break
+		}
+		t = st.Field(i).Type()
+	}
+	return t
+}
+
+// isConcrete reports whether t is a concrete named type declared in pkg,
+// whose methods are listed by go/doc.
+func isConcrete(pkg *types.Package, t types.Type) bool {
+	named, ok := deref(t).(*types.Named)
+	if !ok || named.Obj().Pkg() != pkg {
+		return false
+	}
+	return !types.IsInterface(named)
+}
+
+// embeddedFieldNames returns the names of the exported fields of the types
+// embedded in the named struct type, at any depth.
+func embeddedFieldNames(named *types.Named) []string {
+	var names []string
+	seen := make(map[string]bool)
+	visited := make(map[*types.Named]bool)
+	var walk func(t types.Type, depth int)
+	walk = func(t types.Type, depth int) {
+		t = deref(t)
+		if n, ok := t.(*types.Named); ok {
+			if visited[n.Origin()] {
+				return
+			}
+			visited[n.Origin()] = true
+		}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			return
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			if depth > 0 && f.Exported() && !seen[f.Name()] {
+				seen[f.Name()] = true
+				names = append(names, f.Name())
+			}
+			if f.Embedded() {
+				walk(f.Type(), depth+1)
+			}
+		}
+	}
+	walk(named, 0)
+	return names
+}
+
+func deref(t types.Type) types.Type {
+	if p, ok := t.(*types.Pointer); ok {
+		return p.Elem()
+	}
+	return t
+}
@@ -0,0 +1,65 @@
+package httputil
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes("10.0.0.0/8, 192.168.1.5,::1,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range prefixes {
+		got = append(got, p.String())
+	}
+	want := []string{"10.0.0.0/8", "192.168.1.5/32", "::1/128"}
+	if len(got) != len(want) {
+		t.Fatalf("ParsePrefixes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ParsePrefixes = %v, want %v", got, want)
+			break
+		}
+	}
+
+	for _, bad := range []string{"10.0.0.0/33", "example.com"} {
+		if _, err := ParsePrefixes(bad); err == nil {
+			t.Errorf("ParsePrefixes(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParsePrefixes("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct", "203.0.113.1:1234", nil, "203.0.113.1"},
+		{"untrusted proxy", "203.0.113.1:1234", []string{"198.51.100.7"}, "203.0.113.1"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoofed", "10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.7"}, "198.51.100.7"},
+		{"proxy chain", "10.0.0.1:1234", []string{"198.51.100.7", "10.0.0.2"}, "198.51.100.7"},
+		{"invalid entry", "10.0.0.1:1234", []string{"198.51.100.7, bogus, 10.0.0.2"}, "10.0.0.2"},
+		{"trusted without header", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"mapped", "[::ffff:203.0.113.1]:1234", nil, "203.0.113.1"},
+		{"ipv6", "[2001:db8::1]:1234", nil, "2001:db8::1"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for _, h := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", h)
+		}
+		if got := ClientIP(r, trusted).String(); got != tt.want {
+			t.Errorf("%s: ClientIP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package httputil
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CheckNotModified evaluates the If-None-Match and If-Modified-Since headers
+// of a GET or HEAD request against the entity tag and modification time of
+// the current representation, either of which may be empty. If the client's
+// copy is current, it writes a 304 Not Modified response with the headers
+// already set and returns true.
+func CheckNotModified(w http.ResponseWriter, r *http.Request, etag string, modtime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		// If-None-Match takes precedence over If-Modified-Since
+		if etag == "" || !etagMatch(inm, etag) {
+			return false
+		}
+	} else {
+		ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || modtime.IsZero() || modtime.Truncate(time.Second).After(ims) {
+			return false
+		}
+	}
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch reports whether the list of entity tags of an If-None-Match
+// header matches etag, using the weak comparison function.
+func etagMatch(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckNotModified(t *testing.T) {
+	modtime := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	const etag = `"abc"`
+	for _, tt := range []struct {
+		name   string
+		method string
+		header http.Header
+		want   bool
+	}{
+		{"no conditions", "GET", nil, false},
+		{"if-none-match", "GET", http.Header{"If-None-Match": {etag}}, true},
+		{"if-none-match head", "HEAD", http.Header{"If-None-Match": {etag}}, true},
+		{"if-none-match post", "POST", http.Header{"If-None-Match": {etag}}, false},
+		{"if-none-match list", "GET", http.Header{"If-None-Match": {`"x", W/"abc"`}}, true},
+		{"if-none-match star", "GET", http.Header{"If-None-Match": {"*"}}, true},
+		{"if-none-match changed", "GET", http.Header{"If-None-Match": {`"x"`}}, false},
+		{"if-modified-since", "GET", http.Header{"If-Modified-Since": {modtime.Format(http.TimeFormat)}}, true},
+		{"if-modified-since later", "GET", http.Header{"If-Modified-Since": {modtime.Add(time.Hour).Format(http.TimeFormat)}}, true},
+		{"if-modified-since earlier", "GET", http.Header{"If-Modified-Since": {modtime.Add(-time.Hour).Format(http.TimeFormat)}}, false},
+		{"if-modified-since invalid", "GET", http.Header{"If-Modified-Since": {"yesterday"}}, false},
+		{"if-none-match precedence", "GET", http.Header{
+			"If-None-Match":     {`"x"`},
+			"If-Modified-Since": {modtime.Format(http.TimeFormat)},
+		}, false},
+	} {
+		w := httptest.NewRecorder()
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Etag", etag)
+		r := &http.Request{Method: tt.method, Header: tt.header}
+		if got := CheckNotModified(w, r, etag, modtime); got != tt.want {
+			t.Errorf("%s: CheckNotModified = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		if !tt.want {
+			continue
+		}
+		if w.Code != http.StatusNotModified {
+			t.Errorf("%s: status=%d, want %d", tt.name, w.Code, http.StatusNotModified)
+		}
+		if w.Header().Get("Content-Type") != "" || w.Header().Get("Etag") != etag {
+			t.Errorf("%s: header=%v, want Etag without Content-Type", tt.name, w.Header())
+		}
+	}
+}
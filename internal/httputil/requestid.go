@@ -0,0 +1,23 @@
+package httputil
+
+import "net/http"
+
+// maxRequestIDSize is the maximum size of a request ID set by a client or
+// reverse proxy.
+const maxRequestIDSize = 64
+
+// RequestID returns the ID of the request set in the X-Request-ID header,
+// or the empty string if the header is missing or the ID is not safe to
+// log: IDs are limited in size and to letters, digits, '-', '_' and '.'.
+func RequestID(r *http.Request) string {
+	id := r.Header.Get("X-Request-ID")
+	if len(id) > maxRequestIDSize {
+		return ""
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return ""
+		}
+	}
+	return id
+}
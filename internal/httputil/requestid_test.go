@@ -0,0 +1,31 @@
+package httputil
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"abc-123_DEF.4", "abc-123_DEF.4"},
+		{strings.Repeat("a", maxRequestIDSize), strings.Repeat("a", maxRequestIDSize)},
+		{strings.Repeat("a", maxRequestIDSize+1), ""},
+		{"id with spaces", ""},
+		{"id\nlevel=ERROR msg=forged", ""},
+		{`id"quoted`, ""},
+		{"idé", ""},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.header != "" {
+			r.Header.Set("X-Request-ID", test.header)
+		}
+		if got := RequestID(r); got != test.want {
+			t.Errorf("RequestID(%q) = %q, want %q", test.header, got, test.want)
+		}
+	}
+}
@@ -30,6 +30,14 @@ func (rb *ResponseBuffer) WriteHeader(status int) {
 	rb.status = status
 }
 
+// Status returns the status code of the response.
+func (rb *ResponseBuffer) Status() int {
+	if rb.status == 0 {
+		return http.StatusOK
+	}
+	return rb.status
+}
+
 // Header implements the http.ResponseWriter interface.
 func (rb *ResponseBuffer) Header() http.Header {
 	if rb.header == nil {
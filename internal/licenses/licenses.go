@@ -0,0 +1,256 @@
+// Package licenses detects and classifies software licenses.
+package licenses
+
+import (
+	"bytes"
+	"embed"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// MaxFileSize is the maximum size of a license file.
+const MaxFileSize = 1 << 20
+
+// License is a license file found in a module.
+type License struct {
+	FilePath string   // path of the file relative to the module root
+	Types    []string // SPDX identifiers of the licenses in the file
+	Contents string
+}
+
+// Dir returns the directory containing the license file, relative to the
+// module root.
+func (l *License) Dir() string {
+	return path.Dir(l.FilePath)
+}
+
+// AppliesTo reports whether the license applies to the package in the
+// given directory, relative to the module root. A license applies to the
+// directory containing it and all of its subdirectories.
+func (l *License) AppliesTo(dir string) bool {
+	d := l.Dir()
+	return d == "." || dir == d || strings.HasPrefix(dir, d+"/")
+}
+
+// Known reports whether the file contains at least one recognized license.
+func (l *License) Known() bool {
+	return len(l.Types) > 0
+}
+
+// Detect finds and classifies the license files in the given module
+// filesystem. Directories ignored by the go tool are skipped.
+func Detect(fsys fs.FS) ([]*License, error) {
+	var licenses []*License
+	err := fs.WalkDir(fsys, ".", func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if pathname != "." && (strings.HasPrefix(name, ".") ||
+				name == "testdata" || name == "vendor") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !isLicenseFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() > MaxFileSize {
+			return nil
+		}
+		f, err := fsys.Open(pathname)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		contents, err := io.ReadAll(io.LimitReader(f, MaxFileSize))
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(contents, 0) >= 0 {
+			// Ignore binary files
+			return nil
+		}
+		contents = bytes.ToValidUTF8(contents, []byte("\uFFFD"))
+		licenses = append(licenses, &License{
+			FilePath: pathname,
+			Types:    Classify(string(contents)),
+			Contents: string(contents),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return licenses, nil
+}
+
+// licenseFileRx matches the upper-cased names of license files, such as
+// LICENSE, COPYING.md or LICENSE-MIT.
+var licenseFileRx = regexp.MustCompile(`^(MIT-)?(LICEN[CS]E|COPYING|UNLICEN[CS]E)([-.](MIT|APACHE(-2\.0)?|2\.0|CODE|DOCS))?(\.(MD|MARKDOWN|TXT|RST))?$`)
+
+// isLicenseFile reports whether the file name is the name of a license file.
+func isLicenseFile(name string) bool {
+	return licenseFileRx.MatchString(strings.ToUpper(name))
+}
+
+//go:embed data/*.txt
+var templateFS embed.FS
+
+// A template is the normalized text of a known license.
+type template struct {
+	id       string
+	shingles map[string]struct{}
+}
+
+var (
+	templatesOnce sync.Once
+	templates     []*template
+)
+
+// loadTemplates loads the license templates, sorted by decreasing size.
+func loadTemplates() {
+	entries, err := templateFS.ReadDir("data")
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		b, err := templateFS.ReadFile(path.Join("data", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		templates = append(templates, &template{
+			id:       strings.TrimSuffix(e.Name(), ".txt"),
+			shingles: shingles(stripCopyright(string(b))),
+		})
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return len(templates[i].shingles) > len(templates[j].shingles)
+	})
+}
+
+const (
+	// shingleSize is the number of consecutive words compared at a time.
+	shingleSize = 4
+
+	// minCoverage is the fraction of a license template which must be
+	// present in a file for the license to match.
+	minCoverage = 0.8
+)
+
+// Classify returns the SPDX identifiers of the licenses contained in the given
+// license text. It returns nil if no license was recognized.
+//
+// A license matches if most of the word sequences of its reference text are
+// present in the given text. When two matching licenses largely share the
+// same text (e.g. BSD-2-Clause and BSD-3-Clause), only the license whose
+// distinctive text is better represented is reported.
+func Classify(text string) []string {
+	templatesOnce.Do(loadTemplates)
+
+	doc := shingles(text)
+	var matches []*template
+	for _, t := range templates {
+		if coverage(t.shingles, nil, doc) >= minCoverage {
+			matches = append(matches, t)
+		}
+	}
+
+	dropped := make(map[*template]bool)
+	for i, a := range matches {
+		for _, b := range matches[i+1:] {
+			if dropped[a] || dropped[b] {
+				continue
+			}
+			overlap := 0
+			for s := range b.shingles {
+				if _, ok := a.shingles[s]; ok {
+					overlap++
+				}
+			}
+			// Templates are sorted by size, so b is no larger than a.
+			if overlap*2 < len(b.shingles) {
+				continue
+			}
+			if coverage(b.shingles, a.shingles, doc) > coverage(a.shingles, b.shingles, doc) {
+				dropped[a] = true
+			} else {
+				dropped[b] = true
+			}
+		}
+	}
+
+	var types []string
+	for _, t := range matches {
+		if !dropped[t] {
+			types = append(types, t.id)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// coverage returns the fraction of the shingles in set, excluding those in
+// exclude, which are present in doc.
+func coverage(set, exclude, doc map[string]struct{}) float64 {
+	total, found := 0, 0
+	for s := range set {
+		if _, ok := exclude[s]; ok {
+			continue
+		}
+		total++
+		if _, ok := doc[s]; ok {
+			found++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(found) / float64(total)
+}
+
+// copyrightRx matches copyright notices.
+var copyrightRx = regexp.MustCompile(`(?i)^\s*copyright\s+(\(c\)|©|\d{4}|<year>)`)
+
+// stripCopyright removes copyright notices from a license template, since
+// they vary between uses of a license.
+func stripCopyright(text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if copyrightRx.MatchString(line) {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// shingles returns the set of sequences of shingleSize consecutive words
+// in the normalized text.
+func shingles(text string) map[string]struct{} {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, w := range words {
+		if w == "licence" {
+			words[i] = "license"
+		}
+	}
+	set := make(map[string]struct{})
+	for i := 0; i+shingleSize <= len(words); i++ {
+		set[strings.Join(words[i:i+shingleSize], " ")] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,106 @@
+package licenses
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+const mitLicense = `The MIT License (MIT)
+
+Copyright (c) 2017 Jane Doe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+`
+
+func TestClassify(t *testing.T) {
+	read := func(name string) string {
+		b, err := os.ReadFile("data/" + name + ".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	for _, test := range []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"mit", mitLicense, []string{"MIT"}},
+		{"bsd2", read("BSD-2-Clause"), []string{"BSD-2-Clause"}},
+		{"bsd3", read("BSD-3-Clause"), []string{"BSD-3-Clause"}},
+		{"isc", read("ISC"), []string{"ISC"}},
+		{"0bsd", read("0BSD"), []string{"0BSD"}},
+		{"gpl3", read("GPL-3.0"), []string{"GPL-3.0"}},
+		{"lgpl3", read("LGPL-3.0"), []string{"LGPL-3.0"}},
+		{"dual", read("Apache-2.0") + "\n" + mitLicense, []string{"Apache-2.0", "MIT"}},
+		{"unknown", "All rights reserved. Do not copy.", nil},
+	} {
+		if got := Classify(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	fsys := fstest.MapFS{
+		"LICENSE":              {Data: []byte(mitLicense)},
+		"go.mod":               {Data: []byte("module example.com/m\n")},
+		"sub/COPYING.txt":      {Data: []byte("All rights reserved.")},
+		"sub/pkg/pkg.go":       {Data: []byte("package pkg\n")},
+		"testdata/LICENSE":     {Data: []byte(mitLicense)},
+		"vendor/x/LICENSE.md":  {Data: []byte(mitLicense)},
+		"other/NOTLICENSE.txt": {Data: []byte(mitLicense)},
+	}
+	licenses, err := Detect(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range licenses {
+		got = append(got, l.FilePath)
+	}
+	want := []string{"LICENSE", "sub/COPYING.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if !licenses[0].Known() || licenses[1].Known() {
+		t.Errorf("unexpected classification: %v, %v", licenses[0].Types, licenses[1].Types)
+	}
+	if !licenses[0].AppliesTo("sub/pkg") || !licenses[1].AppliesTo("sub/pkg") {
+		t.Errorf("licenses should apply to sub/pkg")
+	}
+	if licenses[1].AppliesTo("subpkg") || licenses[1].AppliesTo(".") {
+		t.Errorf("sub/COPYING.txt should not apply outside sub")
+	}
+}
+
+func TestIsLicenseFile(t *testing.T) {
+	for _, name := range []string{"LICENSE", "license.md", "LICENCE.txt", "COPYING", "UNLICENSE", "LICENSE-MIT", "LICENSE-APACHE-2.0.txt", "MIT-LICENSE.txt", "LICENSE.docs"} {
+		if !isLicenseFile(name) {
+			t.Errorf("isLicenseFile(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"README.md", "LICENSES", "license.go", "LICENSE-GPL"} {
+		if isLicenseFile(name) {
+			t.Errorf("isLicenseFile(%q) = true, want false", name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package playground provides support for sharing programs with a Go
+// playground, such as https://play.golang.org or a self-hosted instance.
+package playground
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxIDSize is the maximum size of a snippet ID returned by a playground.
+const maxIDSize = 1024
+
+// Client shares programs with a Go playground.
+type Client struct {
+	// ShareURL is the URL to which programs are posted to be shared. The
+	// playground responds with the ID of the shared snippet.
+	ShareURL string
+
+	// ViewURL is a template for the URL at which a shared snippet can be
+	// viewed. The string "{id}" is replaced with the ID of the snippet.
+	ViewURL string
+
+	// Client used for HTTP requests.
+	HTTPClient *http.Client
+
+	// UserAgent used for HTTP requests, if non-empty.
+	UserAgent string
+}
+
+// New returns a client for the playground at the given base URL, using the
+// "/share" and "/p/{id}" endpoints of the official playground. If view is
+// non-empty, it is used as the view URL template instead. New returns nil
+// if the base URL is empty, which disables sharing.
+func New(base, view string, httpClient *http.Client) *Client {
+	if base == "" {
+		return nil
+	}
+	base = strings.TrimSuffix(base, "/")
+	if view == "" {
+		view = base + "/p/{id}"
+	}
+	return &Client{
+		ShareURL:   base + "/share",
+		ViewURL:    view,
+		HTTPClient: httpClient,
+	}
+}
+
+// Share shares the given program and returns the URL at which it can be
+// viewed. The program may contain multiple files in the txtar format.
+func (c *Client) Share(ctx context.Context, src []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.ShareURL, bytes.NewReader(src))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	p, err := io.ReadAll(io.LimitReader(resp.Body, maxIDSize))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error from %s: %s", c.ShareURL, p)
+	}
+	id := strings.TrimSpace(string(p))
+	if id == "" {
+		return "", errors.New("empty snippet ID from " + c.ShareURL)
+	}
+	return strings.ReplaceAll(c.ViewURL, "{id}", url.PathEscape(id)), nil
+}
@@ -0,0 +1,63 @@
+package playground
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShare(t *testing.T) {
+	var got []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/share":
+			http.NotFound(w, r)
+		case r.Method != "POST":
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		case r.Header.Get("User-Agent") != "test-agent":
+			http.Error(w, "bad user agent", http.StatusBadRequest)
+		default:
+			got, _ = io.ReadAll(r.Body)
+			io.WriteString(w, "abc123\n")
+		}
+	}))
+	defer srv.Close()
+
+	const src = "package main\n"
+	for _, test := range []struct {
+		base, view string
+		want       string
+	}{
+		{srv.URL, "", srv.URL + "/p/abc123"},
+		{srv.URL + "/", "", srv.URL + "/p/abc123"},
+		{srv.URL, "https://play.example.com/#{id}", "https://play.example.com/#abc123"},
+	} {
+		c := New(test.base, test.view, srv.Client())
+		c.UserAgent = "test-agent"
+		u, err := c.Share(context.Background(), []byte(src))
+		if err != nil {
+			t.Errorf("New(%q, %q).Share: %v", test.base, test.view, err)
+			continue
+		}
+		if u != test.want {
+			t.Errorf("New(%q, %q).Share = %q, want %q", test.base, test.view, u, test.want)
+		}
+		if string(got) != src {
+			t.Errorf("playground received %q, want %q", got, src)
+		}
+	}
+
+	c := New(srv.URL+"/missing", "", srv.Client())
+	c.UserAgent = "test-agent"
+	if _, err := c.Share(context.Background(), []byte(src)); err == nil {
+		t.Error("Share with missing endpoint succeeded, want error")
+	}
+}
+
+func TestNewDisabled(t *testing.T) {
+	if c := New("", "", nil); c != nil {
+		t.Errorf("New with empty URL = %+v, want nil", c)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"git.sr.ht/~sircmpwn/gddo/internal"
 	"golang.org/x/mod/modfile"
 	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 )
 
 var (
@@ -47,15 +48,28 @@ func (c *Client) Module(modulePath, version string) (*internal.Module, error) {
 	}
 
 	// Get version info
-	info, err := c.getInfo(modulePath, version)
+	latest, err := c.getInfo(modulePath, internal.LatestVersion)
 	if err != nil {
 		return nil, err
 	}
-	latest, err := c.getInfo(modulePath, internal.LatestVersion)
+	versions, err := c.listVersions(modulePath)
 	if err != nil {
 		return nil, err
 	}
-	versions, err := c.listVersions(modulePath)
+
+	// Deprecated and retracted versions are declared in the latest module
+	// file
+	latestMod, err := c.getMod(modulePath, latest.Version)
+	if err != nil {
+		return nil, err
+	}
+	if version == internal.LatestVersion {
+		// Exclude retracted versions from the latest version
+		_, retractions := moduleDirectives(latestMod, modulePath)
+		version = latestUnretracted(latest.Version, versions, retractions)
+	}
+
+	info, err := c.getInfo(modulePath, version)
 	if err != nil {
 		return nil, err
 	}
@@ -69,15 +83,11 @@ func (c *Client) Module(modulePath, version string) (*internal.Module, error) {
 	if path := modfile.ModulePath(mod); path != "" {
 		modulePath = path
 	}
-	// Get deprecated
-	var deprecated string
-	latestMod, err := c.getMod(modulePath, latest.Version)
-	if err != nil {
-		return nil, err
-	}
-	if file, err := modfile.ParseLax("go.mod", latestMod, nil); err == nil {
-		deprecated = file.Module.Deprecated
-	}
+
+	// The directives of the latest module file only apply if it declares
+	// the same module path as the requested version
+	deprecated, retractions := moduleDirectives(latestMod, modulePath)
+	latestVersion := latestUnretracted(latest.Version, versions, retractions)
 
 	seriesPath, _, _ := module.SplitPathVersion(modulePath)
 
@@ -107,12 +117,62 @@ func (c *Client) Module(modulePath, version string) (*internal.Module, error) {
 		RawVersion:    info.Version,
 		Reference:     reference,
 		CommitTime:    info.Time,
-		LatestVersion: latest.Version,
+		LatestVersion: latestVersion,
 		Versions:      versions,
 		Deprecated:    deprecated,
+		Retractions:   retractions,
+		ZipSize:       zipSize,
 	}, nil
 }
 
+// moduleDirectives returns the deprecation message and the retractions
+// declared in the module file, if it declares the given module path.
+func moduleDirectives(gomod []byte, modulePath string) (string, []internal.Retraction) {
+	file, err := modfile.ParseLax("go.mod", gomod, nil)
+	if err != nil || file.Module == nil || file.Module.Mod.Path != modulePath {
+		return "", nil
+	}
+	var retractions []internal.Retraction
+	for _, r := range file.Retract {
+		retractions = append(retractions, internal.Retraction{
+			Low:       r.Low,
+			High:      r.High,
+			Rationale: r.Rationale,
+		})
+	}
+	return file.Module.Deprecated, retractions
+}
+
+// latestUnretracted returns the latest version which has not been retracted,
+// preferring release versions over pre-release versions. If every version has
+// been retracted, it returns the given latest version.
+func latestUnretracted(latest string, versions []string, retractions []internal.Retraction) string {
+	mod := &internal.Module{Retractions: retractions}
+	if !mod.IsRetracted(latest) {
+		return latest
+	}
+	var release, prerelease string
+	for _, v := range versions {
+		if !semver.IsValid(v) || mod.IsRetracted(v) {
+			continue
+		}
+		if semver.Prerelease(v) == "" {
+			if semver.Compare(v, release) > 0 {
+				release = v
+			}
+		} else if semver.Compare(v, prerelease) > 0 {
+			prerelease = v
+		}
+	}
+	switch {
+	case release != "":
+		return release
+	case prerelease != "":
+		return prerelease
+	}
+	return latest
+}
+
 func (c *Client) stdlibModule(version string) (*internal.Module, error) {
 	// Get version info
 	rawVersions, err := c.listVersions(ToolchainModulePath)
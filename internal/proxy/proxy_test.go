@@ -75,3 +75,44 @@ func TestEncodedURL(t *testing.T) {
 		}
 	}
 }
+
+func TestLatestUnretracted(t *testing.T) {
+	versions := []string{"v1.0.0", "v1.1.0", "v1.2.0-pre", "v1.2.0", "v1.3.0"}
+	for _, test := range []struct {
+		latest      string
+		retractions []internal.Retraction
+		want        string
+	}{
+		{"v1.3.0", nil, "v1.3.0"},
+		{"v1.3.0", []internal.Retraction{{Low: "v1.3.0", High: "v1.3.0"}}, "v1.2.0"},
+		{"v1.3.0", []internal.Retraction{{Low: "v1.1.0", High: "v1.3.0"}}, "v1.0.0"},
+		{"v1.3.0", []internal.Retraction{{Low: "v1.0.0", High: "v1.1.0"}, {Low: "v1.2.0", High: "v1.3.0"}}, "v1.2.0-pre"},
+		{"v1.3.0", []internal.Retraction{{Low: "v1.0.0", High: "v1.3.0"}}, "v1.3.0"},
+	} {
+		got := latestUnretracted(test.latest, versions, test.retractions)
+		if got != test.want {
+			t.Errorf("latestUnretracted(%q, %v) = %q, want %q", test.latest, test.retractions, got, test.want)
+		}
+	}
+}
+
+func TestModuleDirectives(t *testing.T) {
+	const gomod = `// Deprecated: use example.org/m/v2.
+module example.org/m
+
+retract v1.0.0 // broken
+`
+	deprecated, retractions := moduleDirectives([]byte(gomod), "example.org/m")
+	if deprecated != "use example.org/m/v2." {
+		t.Errorf("deprecated = %q", deprecated)
+	}
+	if len(retractions) != 1 || retractions[0].Low != "v1.0.0" || retractions[0].Rationale != "broken" {
+		t.Errorf("retractions = %v", retractions)
+	}
+
+	// The module file of another module does not apply
+	deprecated, retractions = moduleDirectives([]byte(gomod), "example.org/other")
+	if deprecated != "" || retractions != nil {
+		t.Errorf("moduleDirectives of other module = %q, %v, want none", deprecated, retractions)
+	}
+}
@@ -0,0 +1,109 @@
+// Package ratelimit implements per-client token bucket rate limits.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// A Limiter limits the rate of events of each of a set of clients. Each
+// client has a bucket of tokens, which is refilled at a constant rate up
+// to a maximum burst size, and each event takes a token from the bucket.
+// A nil *Limiter allows all events.
+type Limiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter allowing each client the given number of events
+// per minute, and bursts of up to burst events. New returns nil if the
+// rate is not positive, which disables the limit.
+func New(perMinute float64, burst int) *Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    perMinute / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow reports whether an event of the client identified by key is
+// allowed, and if so, takes a token from its bucket.
+func (l *Limiter) Allow(key string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * l.rate
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RetryAfter returns the time after which the client identified by key
+// gets a new token, or zero if its bucket has a token.
+func (l *Limiter) RetryAfter(key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.buckets[key]
+	if b == nil {
+		return 0
+	}
+	tokens := b.tokens + l.now().Sub(b.last).Seconds()*l.rate
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - tokens) / l.rate * float64(time.Second)))
+}
+
+// prune removes the buckets which have been refilled completely, which
+// are equivalent to new buckets. Callers must hold l.mu.
+func (l *Limiter) prune(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastPrune) < refill {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
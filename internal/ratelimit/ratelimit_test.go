@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := New(6, 3) // one token every 10 seconds
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("a") {
+			t.Fatalf("event %d of burst denied", i)
+		}
+	}
+	if l.Allow("a") {
+		t.Error("event exceeding burst allowed")
+	}
+	if !l.Allow("b") {
+		t.Error("event of other client denied")
+	}
+
+	now = now.Add(5 * time.Second)
+	if l.Allow("a") {
+		t.Error("event allowed before refill")
+	}
+	now = now.Add(5 * time.Second)
+	if !l.Allow("a") {
+		t.Error("event denied after refill")
+	}
+	if l.Allow("a") {
+		t.Error("second event allowed after refilling one token")
+	}
+
+	if got, want := l.RetryAfter("a"), 10*time.Second; got != want {
+		t.Errorf("RetryAfter = %v, want %v", got, want)
+	}
+	now = now.Add(4 * time.Second)
+	if got, want := l.RetryAfter("a"), 6*time.Second; got != want {
+		t.Errorf("RetryAfter after 4s = %v, want %v", got, want)
+	}
+	if got := l.RetryAfter("b"); got != 0 {
+		t.Errorf("RetryAfter of client with tokens = %v, want 0", got)
+	}
+}
+
+func TestLimiterPrune(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := New(60, 2)
+	l.now = func() time.Time { return now }
+	l.Allow("a")
+	l.Allow("b")
+	now = now.Add(time.Second)
+	l.Allow("b")
+	if len(l.buckets) != 2 {
+		t.Fatalf("limiter has %d buckets, want 2", len(l.buckets))
+	}
+
+	// The bucket of a is refilled after two seconds, that of b after three
+	now = now.Add(time.Second)
+	l.Allow("c")
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("refilled bucket was not pruned")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("bucket in use was pruned")
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	l := New(0, 10)
+	if l != nil {
+		t.Fatalf("New(0, 10) = %v, want nil", l)
+	}
+	if !l.Allow("a") {
+		t.Error("nil limiter denied event")
+	}
+}
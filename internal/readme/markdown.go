@@ -0,0 +1,794 @@
+package readme
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// This file implements a renderer for the commonly used subset of
+// CommonMark and GitHub Flavored Markdown: headings, paragraphs, code
+// blocks, block quotes, lists, tables, thematic breaks, and inline
+// code spans, emphasis, links and images. Raw HTML is dropped.
+
+var (
+	atxHeadingRx   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))??(?:[ \t]+#+)?[ \t]*$`)
+	setextH1Rx     = regexp.MustCompile(`^ {0,3}=+[ \t]*$`)
+	setextH2Rx     = regexp.MustCompile(`^ {0,3}-+[ \t]*$`)
+	thematicRx     = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fenceRx        = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*)$")
+	listItemRx     = regexp.MustCompile(`^( {0,3})([-*+]|[0-9]{1,9}[.)])(?:([ \t]+)(.*))?$`)
+	htmlBlockRx    = regexp.MustCompile(`^ {0,3}<(?:/?[A-Za-z][A-Za-z0-9-]*(?:[ \t/>]|$)|!--)`)
+	linkRefDefRx   = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:[ \t]*<?([^ \t>]+)>?(?:[ \t]+(?:"[^"]*"|'[^']*'|\([^)]*\)))?[ \t]*$`)
+	tableDelimRx   = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	inlineHTMLRx   = regexp.MustCompile(`^(?:</?[A-Za-z][A-Za-z0-9-]*(?:\s+[^<>]*)?/?>|<!--.*?-->)`)
+	autolinkRx     = regexp.MustCompile(`^<((?:https?|mailto):[^ <>]+)>`)
+	bareURLRx      = regexp.MustCompile(`^https?://[^\s<]*[^\s<.,:;"')\]*_~]`)
+	entityRx       = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[A-Za-z][A-Za-z0-9]{1,31});`)
+	asciiPunctChar = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+)
+
+// maxDepth is the maximum nesting depth of blocks and inline links. More
+// deeply nested content is rendered as text, which bounds the rendering
+// time of crafted documents.
+const maxDepth = 16
+
+// markdown holds the state needed to render a Markdown document.
+type markdown struct {
+	w     *writer
+	refs  map[string]string // link reference definitions
+	depth int               // nesting depth of blocks and links
+}
+
+// renderMarkdown renders the Markdown source to w.
+func renderMarkdown(w *writer, src string) {
+	m := &markdown{w: w, refs: make(map[string]string)}
+	lines := strings.Split(expandTabs(src), "\n")
+
+	// Collect link reference definitions
+	var content []string
+	inFence := false
+	for _, line := range lines {
+		if fenceRx.MatchString(line) {
+			inFence = !inFence
+		}
+		if !inFence {
+			if sm := linkRefDefRx.FindStringSubmatch(line); sm != nil {
+				label := normalizeLabel(sm[1])
+				if _, ok := m.refs[label]; !ok {
+					m.refs[label] = sm[2]
+				}
+				continue
+			}
+		}
+		content = append(content, line)
+	}
+	m.blocks(content, false)
+}
+
+// expandTabs replaces tabs at the start of lines with spaces.
+func expandTabs(src string) string {
+	if !strings.Contains(src, "\t") {
+		return src
+	}
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		var b strings.Builder
+		col := 0
+		for j, r := range line {
+			if r == '\t' {
+				n := 4 - col%4
+				b.WriteString(strings.Repeat(" ", n))
+				col += n
+				continue
+			}
+			if r != ' ' {
+				b.WriteString(line[j:])
+				break
+			}
+			b.WriteRune(r)
+			col++
+		}
+		lines[i] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// interrupts reports whether the line starts a block which interrupts
+// a paragraph.
+func interrupts(line string) bool {
+	if atxHeadingRx.MatchString(line) || thematicRx.MatchString(line) ||
+		fenceRx.MatchString(line) || htmlBlockRx.MatchString(line) {
+		return true
+	}
+	if strings.HasPrefix(strings.TrimLeft(line, " "), ">") && indentOf(line) < 4 {
+		return true
+	}
+	if sm := listItemRx.FindStringSubmatch(line); sm != nil && sm[4] != "" {
+		// Only bullet lists and lists starting at 1 interrupt paragraphs
+		marker := sm[2]
+		return !isDigit(marker[0]) || strings.TrimLeft(marker[:len(marker)-1], "0") == "1"
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// blocks renders the given lines as a sequence of blocks. If tight is true,
+// paragraphs are rendered without enclosing paragraph tags.
+func (m *markdown) blocks(lines []string, tight bool) {
+	w := m.w
+	m.depth++
+	defer func() { m.depth-- }()
+	if m.depth > maxDepth {
+		w.WriteString("<p>")
+		w.escape(strings.TrimSpace(strings.Join(lines, "\n")))
+		w.WriteString("</p>\n")
+		return
+	}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+
+		case indentOf(line) >= 4:
+			// Indented code block
+			var code []string
+			for ; i < len(lines) && (isBlank(lines[i]) || indentOf(lines[i]) >= 4); i++ {
+				if len(lines[i]) >= 4 {
+					code = append(code, lines[i][4:])
+				} else {
+					code = append(code, "")
+				}
+			}
+			for len(code) > 0 && isBlank(code[len(code)-1]) {
+				code = code[:len(code)-1]
+			}
+			m.code(code, "")
+
+		case fenceRx.MatchString(line):
+			sm := fenceRx.FindStringSubmatch(line)
+			indent, fence := len(sm[1]), sm[2]
+			lang, _, _ := strings.Cut(strings.TrimSpace(sm[3]), " ")
+			var code []string
+			for i++; i < len(lines); i++ {
+				l := lines[i]
+				if t := strings.TrimSpace(l); indentOf(l) < 4 && strings.HasPrefix(t, fence) &&
+					strings.Trim(t, fence[:1]) == "" {
+					i++
+					break
+				}
+				n := indentOf(l)
+				if n > indent {
+					n = indent
+				}
+				code = append(code, l[n:])
+			}
+			m.code(code, lang)
+
+		case atxHeadingRx.MatchString(line):
+			sm := atxHeadingRx.FindStringSubmatch(line)
+			w.heading(len(sm[1]), sm[2], m.inlineFunc)
+			i++
+
+		case thematicRx.MatchString(line):
+			w.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(strings.TrimLeft(line, " "), ">"):
+			var quoted []string
+			for ; i < len(lines); i++ {
+				l := strings.TrimLeft(lines[i], " ")
+				if strings.HasPrefix(l, ">") {
+					l = strings.TrimPrefix(l[1:], " ")
+				} else if isBlank(l) || interrupts(lines[i]) {
+					break
+				}
+				quoted = append(quoted, l)
+			}
+			w.WriteString("<blockquote>\n")
+			m.blocks(quoted, false)
+			w.WriteString("</blockquote>\n")
+
+		case listItemRx.MatchString(line):
+			i = m.list(lines, i)
+
+		case htmlBlockRx.MatchString(line):
+			// Raw HTML is not rendered
+			for ; i < len(lines) && !isBlank(lines[i]); i++ {
+			}
+
+		case i+1 < len(lines) && strings.Contains(line, "|") &&
+			tableDelimRx.MatchString(lines[i+1]) &&
+			len(splitRow(line)) == len(splitRow(lines[i+1])):
+			i = m.table(lines, i)
+
+		default:
+			// Paragraph, or setext heading
+			var para []string
+			level := 0
+			for ; i < len(lines); i++ {
+				l := lines[i]
+				if isBlank(l) {
+					break
+				}
+				if len(para) > 0 {
+					if setextH1Rx.MatchString(l) {
+						level = 1
+					} else if setextH2Rx.MatchString(l) {
+						level = 2
+					}
+					if level > 0 {
+						i++
+						break
+					}
+					if interrupts(l) {
+						break
+					}
+				}
+				para = append(para, strings.TrimLeft(l, " "))
+			}
+			text := strings.TrimRight(strings.Join(para, "\n"), " ")
+			if level > 0 {
+				w.heading(level, text, m.inlineFunc)
+				continue
+			}
+			if !tight {
+				w.WriteString("<p>")
+			}
+			m.inline(text)
+			if !tight {
+				w.WriteString("</p>")
+			}
+			w.WriteString("\n")
+		}
+	}
+}
+
+// code writes a code block.
+func (m *markdown) code(lines []string, lang string) {
+	w := m.w
+	w.WriteString("<pre><code")
+	if lang != "" {
+		w.WriteString(` class="language-`)
+		w.escape(lang)
+		w.WriteString(`"`)
+	}
+	w.WriteString(">")
+	for _, l := range lines {
+		w.escape(l)
+		w.WriteString("\n")
+	}
+	w.WriteString("</code></pre>\n")
+}
+
+// list renders the list starting at lines[i] and returns the index of the
+// line following the list.
+func (m *markdown) list(lines []string, i int) int {
+	first := listItemRx.FindStringSubmatch(lines[i])
+	ordered := isDigit(first[2][0])
+	delim := first[2][len(first[2])-1]
+
+	var items [][]string
+	tight := true
+	blank := false
+	contentIndent := 0
+items:
+	for i < len(lines) {
+		line := lines[i]
+		if sm := listItemRx.FindStringSubmatch(line); sm != nil && (len(items) == 0 || indentOf(line) < contentIndent) {
+			marker := sm[2]
+			if isDigit(marker[0]) != ordered || marker[len(marker)-1] != delim {
+				break
+			}
+			if blank && len(items) > 0 {
+				tight = false
+			}
+			// Start a new item
+			spaces := len(sm[3])
+			first := sm[4]
+			if spaces > 4 {
+				// The item starts with an indented code block
+				first = sm[3][1:] + first
+				spaces = 1
+			} else if first == "" {
+				spaces = 1
+			}
+			contentIndent = len(sm[1]) + len(marker) + spaces
+			items = append(items, []string{first})
+			blank = false
+			i++
+			continue
+		}
+		item := &items[len(items)-1]
+		switch {
+		case isBlank(line):
+			blank = true
+			*item = append(*item, "")
+		case indentOf(line) >= contentIndent:
+			if blank {
+				// Blank lines within an item make a loose list, unless
+				// they only precede a nested block.
+				if n := len(*item); n < 2 || !isBlank((*item)[n-2]) && indentOf(line) == contentIndent {
+					tight = false
+				}
+				blank = false
+			}
+			*item = append(*item, line[contentIndent:])
+		case !blank && !interrupts(line):
+			// Lazy continuation line
+			*item = append(*item, strings.TrimLeft(line, " "))
+		default:
+			break items
+		}
+		i++
+	}
+
+	w := m.w
+	if ordered {
+		start, _ := strconv.Atoi(first[2][:len(first[2])-1])
+		if start != 1 {
+			w.WriteString(`<ol start="` + strconv.Itoa(start) + `">` + "\n")
+		} else {
+			w.WriteString("<ol>\n")
+		}
+	} else {
+		w.WriteString("<ul>\n")
+	}
+	for _, item := range items {
+		w.WriteString("<li>")
+		m.blocks(item, tight)
+		w.WriteString("</li>\n")
+	}
+	if ordered {
+		w.WriteString("</ol>\n")
+	} else {
+		w.WriteString("</ul>\n")
+	}
+	return i
+}
+
+// splitRow splits a table row into cells.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	start := 0
+	inCode := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '`':
+			inCode = !inCode
+		case '|':
+			if !inCode {
+				cells = append(cells, strings.TrimSpace(line[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	cells = append(cells, strings.TrimSpace(line[start:]))
+	for i, c := range cells {
+		cells[i] = strings.ReplaceAll(c, `\|`, "|")
+	}
+	return cells
+}
+
+// table renders the table starting at lines[i] and returns the index of the
+// line following the table.
+func (m *markdown) table(lines []string, i int) int {
+	w := m.w
+	header := splitRow(lines[i])
+	var align []string
+	for _, d := range splitRow(lines[i+1]) {
+		switch {
+		case strings.HasPrefix(d, ":") && strings.HasSuffix(d, ":"):
+			align = append(align, "center")
+		case strings.HasSuffix(d, ":"):
+			align = append(align, "right")
+		case strings.HasPrefix(d, ":"):
+			align = append(align, "left")
+		default:
+			align = append(align, "")
+		}
+	}
+	row := func(tag string, cells []string) {
+		w.WriteString("<tr>")
+		for j := range header {
+			w.WriteString("<" + tag)
+			if align[j] != "" {
+				w.WriteString(` style="text-align: ` + align[j] + `"`)
+			}
+			w.WriteString(">")
+			if j < len(cells) {
+				m.inline(cells[j])
+			}
+			w.WriteString("</" + tag + ">")
+		}
+		w.WriteString("</tr>\n")
+	}
+
+	w.WriteString(`<table class="table table-sm">` + "\n<thead>\n")
+	row("th", header)
+	w.WriteString("</thead>\n<tbody>\n")
+	for i += 2; i < len(lines); i++ {
+		if isBlank(lines[i]) || interrupts(lines[i]) {
+			break
+		}
+		row("td", splitRow(lines[i]))
+	}
+	w.WriteString("</tbody>\n</table>\n")
+	return i
+}
+
+func (m *markdown) inlineFunc(w *writer, text string) {
+	m.inline(text)
+}
+
+// inline renders inline Markdown text.
+func (m *markdown) inline(s string) {
+	w := m.w
+	m.depth++
+	defer func() { m.depth-- }()
+	if m.depth > maxDepth {
+		w.escape(s)
+		return
+	}
+
+	// Delimiter runs are not written when they are found, but spliced
+	// into the output once emphasis has been resolved
+	start := w.Len()
+	var runs []*delimRun
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(asciiPunctChar, s[i+1]) >= 0:
+			w.escape(s[i+1 : i+2])
+			i += 2
+			continue
+
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			w.WriteString("<br>\n")
+			i += 2
+			continue
+
+		case c == '\n':
+			if strings.HasSuffix(s[:i], "  ") {
+				w.WriteString("<br>")
+			}
+			w.WriteString("\n")
+			i++
+			continue
+
+		case c == '`':
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			fence := s[i : i+n]
+			if end := closingBackticks(s[i+n:], n); end >= 0 {
+				code := strings.ReplaceAll(s[i+n:i+n+end], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+				w.WriteString("<code>")
+				w.escape(code)
+				w.WriteString("</code>")
+				i += n + end + n
+			} else {
+				w.escape(fence)
+				i += n
+			}
+			continue
+
+		case c == '!' && strings.HasPrefix(s[i+1:], "["):
+			if text, dest, n, ok := m.parseLink(s[i+1:]); ok {
+				w.image(dest, plainText(text))
+				i += 1 + n
+				continue
+			}
+
+		case c == '[':
+			if text, dest, n, ok := m.parseLink(s[i:]); ok {
+				w.link(dest, func() { m.inline(text) })
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if sm := autolinkRx.FindStringSubmatch(s[i:]); sm != nil {
+				w.link(sm[1], func() { w.escape(sm[1]) })
+				i += len(sm[0])
+				continue
+			}
+			if loc := inlineHTMLRx.FindStringIndex(s[i:]); loc != nil {
+				// Raw HTML is not rendered
+				i += loc[1]
+				continue
+			}
+
+		case c == '&':
+			if loc := entityRx.FindStringIndex(s[i:]); loc != nil {
+				w.WriteString(s[i : i+loc[1]])
+				i += loc[1]
+				continue
+			}
+
+		case c == 'h' && (i == 0 || !isWordChar(s[i-1])):
+			if loc := bareURLRx.FindStringIndex(s[i:]); loc != nil {
+				u := s[i : i+loc[1]]
+				w.link(u, func() { w.escape(u) })
+				i += loc[1]
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if r := scanDelimRun(s, i); r != nil {
+				r.pos = w.Len() - start
+				runs = append(runs, r)
+				i += r.n
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		w.escape(s[i : i+size])
+		i += size
+	}
+	if len(runs) > 0 {
+		matchEmphasis(runs)
+		out := append([]byte(nil), w.Bytes()[start:]...)
+		w.Truncate(start)
+		pos := 0
+		for _, r := range runs {
+			w.Write(out[pos:r.pos])
+			w.WriteString(r.closeTags)
+			w.WriteString(strings.Repeat(string(r.c), r.n))
+			w.WriteString(r.openTags)
+			pos = r.pos
+		}
+		w.Write(out[pos:])
+	}
+}
+
+// closingBackticks returns the index of the run of exactly n backticks in s,
+// or -1 if there is none.
+func closingBackticks(s string, n int) int {
+	for i := 0; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && s[j] == '`' {
+			j++
+		}
+		if j-i == n {
+			return i
+		}
+		i = j
+	}
+	return -1
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// A delimRun is a run of emphasis delimiters in inline text.
+type delimRun struct {
+	c                 byte
+	length            int // length of the run
+	n                 int // number of delimiters not used for emphasis
+	pos               int // position in the rendered output
+	canOpen, canClose bool
+	openTags          string // written after the unused delimiters
+	closeTags         string // written before the unused delimiters
+}
+
+// scanDelimRun returns the run of emphasis delimiters starting at s[i],
+// or nil if s[i] does not start one.
+func scanDelimRun(s string, i int) *delimRun {
+	c := s[i]
+	j := i
+	for j < len(s) && s[j] == c {
+		j++
+	}
+	if c == '~' && j-i != 2 {
+		return nil
+	}
+	prev, next := rune(' '), rune(' ')
+	if i > 0 {
+		prev, _ = utf8.DecodeLastRuneInString(s[:i])
+	}
+	if j < len(s) {
+		next, _ = utf8.DecodeRuneInString(s[j:])
+	}
+	left := !unicode.IsSpace(next) &&
+		(!isPunct(next) || unicode.IsSpace(prev) || isPunct(prev))
+	right := !unicode.IsSpace(prev) &&
+		(!isPunct(prev) || unicode.IsSpace(next) || isPunct(next))
+	r := &delimRun{c: c, length: j - i, n: j - i, canOpen: left, canClose: right}
+	if c == '_' {
+		// Underscores do not emphasize parts of words
+		r.canOpen = left && (!right || isPunct(prev))
+		r.canClose = right && (!left || isPunct(next))
+	}
+	if !r.canOpen && !r.canClose {
+		return nil
+	}
+	return r
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// matchEmphasis matches openers and closers among the delimiter runs, and
+// records the resulting tags in the runs. Runs between a matched opener
+// and closer cannot match each other, nor runs outside of them.
+func matchEmphasis(runs []*delimRun) {
+	type closerKind struct {
+		c       byte
+		canOpen bool
+		mod3    int
+	}
+	var openers []*delimRun
+	// For each kind of closer, the length of the openers stack below
+	// which no opener matches
+	bottom := make(map[closerKind]int)
+	for _, r := range runs {
+		for r.canClose && r.n > 0 {
+			kind := closerKind{r.c, r.canOpen, r.length % 3}
+			k := -1
+			for j := len(openers) - 1; j >= bottom[kind]; j-- {
+				o := openers[j]
+				// Runs which can both open and close only match runs
+				// with a combined length which is not a multiple of 3,
+				// unless both lengths are
+				if o.c == r.c && (!o.canClose && !r.canOpen ||
+					(o.length+r.length)%3 != 0 ||
+					o.length%3 == 0 && r.length%3 == 0) {
+					k = j
+					break
+				}
+			}
+			if k < 0 {
+				bottom[kind] = len(openers)
+				break
+			}
+			o := openers[k]
+			n := 1
+			if o.n >= 2 && r.n >= 2 {
+				n = 2
+			}
+			tag := "em"
+			switch {
+			case r.c == '~':
+				tag = "del"
+			case n == 2:
+				tag = "strong"
+			}
+			o.openTags = "<" + tag + ">" + o.openTags
+			r.closeTags += "</" + tag + ">"
+			o.n -= n
+			r.n -= n
+			openers = openers[:k+1]
+			if o.n == 0 {
+				openers = openers[:k]
+			}
+			for kind, b := range bottom {
+				bottom[kind] = min(b, len(openers))
+			}
+		}
+		if r.canOpen && r.n > 0 {
+			openers = append(openers, r)
+		}
+	}
+}
+
+// parseLink parses an inline or reference link starting with the '[' at s[0].
+// It returns the link text, the destination, and the number of bytes consumed.
+func (m *markdown) parseLink(s string) (text, dest string, n int, ok bool) {
+	// Find the closing bracket
+	depth := 0
+	end := -1
+loop:
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '`':
+			if j := closingBackticks(s[i+1:], 1); j >= 0 {
+				i += j + 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				end = i
+				break loop
+			}
+		}
+	}
+	if end < 0 {
+		return "", "", 0, false
+	}
+	text = s[1:end]
+	rest := s[end+1:]
+
+	// Inline link
+	if strings.HasPrefix(rest, "(") {
+		depth := 0
+		for i := 0; i < len(rest); i++ {
+			switch rest[i] {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					inner := strings.TrimSpace(rest[1:i])
+					if strings.HasPrefix(inner, "<") {
+						if j := strings.IndexByte(inner, '>'); j >= 0 {
+							inner = inner[1:j]
+						}
+					} else if j := strings.IndexAny(inner, " \t\n"); j >= 0 {
+						// Drop the link title
+						inner = inner[:j]
+					}
+					return text, inner, end + 1 + i + 1, true
+				}
+			case '\n':
+				if depth == 1 && i > 0 && rest[i-1] == '\n' {
+					return "", "", 0, false
+				}
+			}
+		}
+		return "", "", 0, false
+	}
+
+	// Full and collapsed reference links
+	if strings.HasPrefix(rest, "[") {
+		if j := strings.IndexByte(rest, ']'); j >= 0 {
+			label := rest[1:j]
+			if label == "" {
+				label = text
+			}
+			if d, ok := m.refs[normalizeLabel(label)]; ok {
+				return text, d, end + 1 + j + 1, true
+			}
+		}
+	}
+
+	// Shortcut reference links
+	if d, ok := m.refs[normalizeLabel(text)]; ok {
+		return text, d, end + 1, true
+	}
+	return "", "", 0, false
+}
+
+// plainText returns the text content of inline Markdown, for use as
+// alternative text.
+func plainText(s string) string {
+	return strings.NewReplacer("*", "", "_", "", "`", "", "[", "", "]", "").Replace(s)
+}
@@ -0,0 +1,228 @@
+// Package readme extracts and renders module README files.
+//
+// README files are rendered into HTML by this package rather than passed
+// through, so raw HTML in a README is never included in the output.
+package readme
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxFileSize is the maximum size of a README file.
+const MaxFileSize = 512 * 1024
+
+// Readme is a README file found in a module.
+type Readme struct {
+	FilePath string // path of the file relative to the module root
+	Contents string
+
+	// Rendered holds the output of HTML, if the README was rendered
+	// when it was stored.
+	Rendered template.HTML
+}
+
+// A Resolver returns the URL for a file path relative to the module root.
+// If image is true, the URL should refer to the raw file contents.
+// It returns the empty string if no URL is available.
+type Resolver func(path string, image bool) string
+
+// extensions lists the supported README file extensions, in order of
+// preference.
+var extensions = []string{".md", ".markdown", ".rst", ".org", ".txt", ""}
+
+// Detect returns the README file at the root of the module filesystem.
+// It returns nil if the module has no README file.
+func Detect(fsys fs.FS) (*Readme, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var best fs.DirEntry
+	bestRank := len(extensions)
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		name := strings.ToLower(e.Name())
+		if !strings.HasPrefix(name, "readme") {
+			continue
+		}
+		for rank, ext := range extensions {
+			if name == "readme"+ext && rank < bestRank {
+				best, bestRank = e, rank
+			}
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	f, err := fsys.Open(best.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	contents, err := io.ReadAll(io.LimitReader(f, MaxFileSize))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(contents, 0) >= 0 {
+		// Ignore binary files
+		return nil, nil
+	}
+	contents = bytes.ToValidUTF8(contents, []byte("�"))
+	return &Readme{
+		FilePath: best.Name(),
+		Contents: string(contents),
+	}, nil
+}
+
+// HTML renders the README as HTML. Relative links and images are rewritten
+// with the given resolver.
+func (r *Readme) HTML(resolve Resolver) template.HTML {
+	w := &writer{
+		dir:     path.Dir(r.FilePath),
+		resolve: resolve,
+		ids:     make(map[string]int),
+	}
+	src := strings.ReplaceAll(r.Contents, "\r\n", "\n")
+	switch strings.ToLower(path.Ext(r.FilePath)) {
+	case ".md", ".markdown":
+		renderMarkdown(w, src)
+	case ".rst":
+		w.blocks(parseRST(src), rstInline)
+	case ".org":
+		w.blocks(parseOrg(src), orgInline)
+	default:
+		w.WriteString("<pre>")
+		w.escape(src)
+		w.WriteString("</pre>\n")
+	}
+	return template.HTML(w.String())
+}
+
+// writer accumulates rendered HTML.
+type writer struct {
+	bytes.Buffer
+	dir     string
+	resolve Resolver
+	ids     map[string]int
+}
+
+// escape writes s to the output as HTML text.
+func (w *writer) escape(s string) {
+	template.HTMLEscape(w, []byte(s))
+}
+
+// linkURL returns the URL for the given link destination, or the empty
+// string if the link should not be rendered.
+func (w *writer) linkURL(dest string, image bool) string {
+	u, err := url.Parse(strings.TrimSpace(dest))
+	if err != nil {
+		return ""
+	}
+	switch {
+	case u.Scheme == "http" || u.Scheme == "https":
+		return u.String()
+	case u.Scheme == "mailto" && !image:
+		return u.String()
+	case u.Scheme != "" || u.Host != "" || u.Opaque != "":
+		return ""
+	case u.Path == "" && u.Fragment != "" && !image:
+		return "#" + headingPrefix + slug(u.Fragment)
+	case u.Path == "" || w.resolve == nil:
+		return ""
+	}
+	p := u.Path
+	if strings.HasPrefix(p, "/") {
+		p = path.Clean(p[1:])
+	} else {
+		p = path.Join(w.dir, p)
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return ""
+	}
+	link := w.resolve(p, image)
+	if link != "" && u.Fragment != "" && !image {
+		link += "#" + url.PathEscape(u.Fragment)
+	}
+	return link
+}
+
+// link writes a link to dest around the text written by text.
+func (w *writer) link(dest string, text func()) {
+	u := w.linkURL(dest, false)
+	if u == "" {
+		text()
+		return
+	}
+	w.WriteString(`<a rel="noopener nofollow" href="`)
+	w.escape(u)
+	w.WriteString(`">`)
+	text()
+	w.WriteString("</a>")
+}
+
+// image writes an image, or its alternative text if the image cannot be
+// resolved.
+func (w *writer) image(dest, alt string) {
+	u := w.linkURL(dest, true)
+	if u == "" {
+		w.escape(alt)
+		return
+	}
+	w.WriteString(`<img src="`)
+	w.escape(u)
+	w.WriteString(`" alt="`)
+	w.escape(alt)
+	w.WriteString(`">`)
+}
+
+// headingPrefix is prepended to heading IDs to avoid collisions with
+// the IDs used by package documentation.
+const headingPrefix = "readme-"
+
+// heading writes a heading. Heading levels are shifted so that README
+// headings nest below the page headings.
+func (w *writer) heading(level int, text string, inline func(*writer, string)) {
+	level += 2
+	if level > 6 {
+		level = 6
+	}
+	id := slug(text)
+	if n := w.ids[id]; n > 0 {
+		w.ids[id] = n + 1
+		id = id + "-" + strconv.Itoa(n)
+	} else {
+		w.ids[id] = 1
+	}
+	tag := "h" + strconv.Itoa(level)
+	w.WriteString("<" + tag + ` id="` + headingPrefix)
+	w.escape(id)
+	w.WriteString(`">`)
+	inline(w, text)
+	w.WriteString("</" + tag + ">\n")
+}
+
+// slug returns a heading ID for the given heading text, in the manner of
+// popular forges.
+func slug(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
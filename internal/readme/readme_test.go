@@ -0,0 +1,180 @@
+package readme
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testResolver(path string, image bool) string {
+	if image {
+		return "https://raw.example.com/" + path
+	}
+	return "https://example.com/" + path
+}
+
+func TestHTML(t *testing.T) {
+	for _, test := range []struct {
+		name, file, src, want string
+	}{
+		{
+			"heading", "README.md",
+			"# Title\n\nSome *text*.\n",
+			`<h3 id="readme-title">Title</h3>` + "\n<p>Some <em>text</em>.</p>\n",
+		},
+		{
+			"setext", "README.md",
+			"Title\n=====\n",
+			`<h3 id="readme-title">Title</h3>` + "\n",
+		},
+		{
+			"duplicate headings", "README.md",
+			"## Usage\n## Usage\n",
+			`<h4 id="readme-usage">Usage</h4>` + "\n" + `<h4 id="readme-usage-1">Usage</h4>` + "\n",
+		},
+		{
+			"fenced code", "README.md",
+			"```go\nfmt.Println(\"<hi>\")\n```\n",
+			`<pre><code class="language-go">fmt.Println(&#34;&lt;hi&gt;&#34;)` + "\n</code></pre>\n",
+		},
+		{
+			"raw html", "README.md",
+			"<script>alert(1)</script>\n\nText <b>bold</b>.\n",
+			"<p>Text bold.</p>\n",
+		},
+		{
+			"relative link", "README.md",
+			"[doc](docs/guide.md#intro)\n",
+			`<p><a rel="noopener nofollow" href="https://example.com/docs/guide.md#intro">doc</a></p>` + "\n",
+		},
+		{
+			"relative image", "README.md",
+			"![logo](./logo.png)\n",
+			`<p><img src="https://raw.example.com/logo.png" alt="logo"></p>` + "\n",
+		},
+		{
+			"fragment link", "README.md",
+			"[see](#Getting-Started)\n",
+			`<p><a rel="noopener nofollow" href="#readme-getting-started">see</a></p>` + "\n",
+		},
+		{
+			"unsafe link", "README.md",
+			"[x](javascript:alert(1)) [y](../outside)\n",
+			"<p>x y</p>\n",
+		},
+		{
+			"reference link", "README.md",
+			"See [the docs][d].\n\n[d]: https://example.org/\n",
+			`<p>See <a rel="noopener nofollow" href="https://example.org/">the docs</a>.</p>` + "\n",
+		},
+		{
+			"emphasis", "README.md",
+			"**bold**, *em*, ***both***, ~~del~~ and *a **b** c*\n",
+			"<p><strong>bold</strong>, <em>em</em>, <em><strong>both</strong></em>, " +
+				"<del>del</del> and <em>a <strong>b</strong> c</em></p>\n",
+		},
+		{
+			"intraword emphasis", "README.md",
+			"snake_case_name, a*b*c, *foo**bar**baz* and a * b\n",
+			"<p>snake_case_name, a<em>b</em>c, <em>foo<strong>bar</strong>baz</em> and a * b</p>\n",
+		},
+		{
+			"unmatched emphasis", "README.md",
+			"**a* and _b\n",
+			"<p>*<em>a</em> and _b</p>\n",
+		},
+		{
+			"tight list", "README.md",
+			"- one\n- two\n",
+			"<ul>\n<li>one\n</li>\n<li>two\n</li>\n</ul>\n",
+		},
+		{
+			"table", "README.md",
+			"| a | b |\n|---|--:|\n| 1 | 2 |\n",
+			`<table class="table table-sm">` + "\n<thead>\n<tr><th>a</th>" + `<th style="text-align: right">b</th></tr>` +
+				"\n</thead>\n<tbody>\n<tr><td>1</td>" + `<td style="text-align: right">2</td></tr>` + "\n</tbody>\n</table>\n",
+		},
+		{
+			"rst", "README.rst",
+			"Title\n=====\n\nUse ``go get``::\n\n    go get example.com/m\n",
+			`<h3 id="readme-title">Title</h3>` + "\n<p>Use <code>go get</code>:</p>\n<pre><code>go get example.com/m</code></pre>\n",
+		},
+		{
+			"rst link", "README.rst",
+			"See `the site <https://example.org/>`_.\n",
+			`<p>See <a rel="noopener nofollow" href="https://example.org/">the site</a>.</p>` + "\n",
+		},
+		{
+			"org", "README.org",
+			"* Title\n\nSee [[file:doc.org][the doc]] and =code=.\n",
+			`<h3 id="readme-title">Title</h3>` + "\n" +
+				`<p>See <a rel="noopener nofollow" href="https://example.com/doc.org">the doc</a> and <code>code</code>.</p>` + "\n",
+		},
+		{
+			"text", "README",
+			"a <b>\n",
+			"<pre>a &lt;b&gt;\n</pre>\n",
+		},
+	} {
+		r := &Readme{FilePath: test.file, Contents: test.src}
+		if got := string(r.HTML(testResolver)); got != test.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestHTMLNesting(t *testing.T) {
+	// Deeply nested content is rendered as text
+	src := strings.Repeat("> ", maxDepth+2) + "*a*\n"
+	r := &Readme{FilePath: "README.md", Contents: src}
+	want := strings.Repeat("<blockquote>\n", maxDepth) + "<p>&gt; &gt; *a*</p>\n" +
+		strings.Repeat("</blockquote>\n", maxDepth)
+	if got := string(r.HTML(testResolver)); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	// Crafted documents are rendered in linear time
+	for _, src := range []string{
+		strings.Repeat("- ", 20000) + "a\n",
+		strings.Repeat("> - ", 10000) + "a\n",
+		strings.Repeat("*a ", 20000) + "\n",
+		strings.Repeat("[", 20000) + "a" + strings.Repeat("](b)", 20000) + "\n",
+	} {
+		r := &Readme{FilePath: "README.md", Contents: src}
+		r.HTML(testResolver)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	fsys := fstest.MapFS{
+		"README":          {Data: []byte("plain")},
+		"README.md":       {Data: []byte("# markdown")},
+		"readme.rst":      {Data: []byte("rst")},
+		"sub/README.md":   {Data: []byte("nested")},
+		"README.md.orig":  {Data: []byte("backup")},
+		"READMEFIRST.txt": {Data: []byte("other")},
+	}
+	r, err := Detect(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil || r.FilePath != "README.md" || r.Contents != "# markdown" {
+		t.Errorf("Detect() = %+v, want README.md", r)
+	}
+
+	r, err = Detect(fstest.MapFS{"main.go": {Data: []byte("package main")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != nil {
+		t.Errorf("Detect() = %+v, want nil", r)
+	}
+
+	r, err = Detect(fstest.MapFS{"README": {Data: []byte(strings.Repeat("x", 10) + "\x00")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != nil {
+		t.Errorf("Detect() = %+v, want nil for binary file", r)
+	}
+}
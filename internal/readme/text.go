@@ -0,0 +1,420 @@
+package readme
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file implements renderers for the structural subset of
+// reStructuredText and Org mode documents: headings, paragraphs, literal
+// blocks, lists, and inline code, emphasis and links. Directives which
+// are not understood are dropped.
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	headingBlock
+	codeBlock
+	listBlock
+)
+
+// A block is a block of a reStructuredText or Org mode document.
+type block struct {
+	kind    blockKind
+	level   int      // heading level
+	ordered bool     // ordered list
+	text    string   // paragraph, heading or code text
+	items   []string // list item text
+}
+
+// blocks renders the blocks, using inline to render inline text.
+func (w *writer) blocks(blocks []block, inline func(*writer, string)) {
+	for _, b := range blocks {
+		switch b.kind {
+		case headingBlock:
+			w.heading(b.level, b.text, inline)
+		case codeBlock:
+			w.WriteString("<pre><code>")
+			w.escape(b.text)
+			w.WriteString("</code></pre>\n")
+		case listBlock:
+			tag := "ul"
+			if b.ordered {
+				tag = "ol"
+			}
+			w.WriteString("<" + tag + ">\n")
+			for _, item := range b.items {
+				w.WriteString("<li>")
+				inline(w, item)
+				w.WriteString("</li>\n")
+			}
+			w.WriteString("</" + tag + ">\n")
+		default:
+			w.WriteString("<p>")
+			inline(w, b.text)
+			w.WriteString("</p>\n")
+		}
+	}
+}
+
+// bulletRx matches list items in reStructuredText and Org mode documents.
+var bulletRx = regexp.MustCompile(`^( *)([-*+]|[0-9]+[.)]|#\.) +(.*)$`)
+
+// paragraphs accumulates paragraph and list lines for the text parsers.
+type paragraphs struct {
+	blocks []block
+	lines  []string
+	list   *block
+	indent int // content indentation of the current list item
+}
+
+// flush ends the current paragraph or list.
+func (p *paragraphs) flush() {
+	if len(p.lines) > 0 {
+		p.blocks = append(p.blocks, block{kind: paragraphBlock, text: strings.Join(p.lines, "\n")})
+		p.lines = nil
+	}
+	if p.list != nil {
+		p.blocks = append(p.blocks, *p.list)
+		p.list = nil
+	}
+}
+
+// add adds a block, ending the current paragraph or list.
+func (p *paragraphs) add(b block) {
+	p.flush()
+	p.blocks = append(p.blocks, b)
+}
+
+// line adds a line of text to the current paragraph or list.
+func (p *paragraphs) line(line string) {
+	if sm := bulletRx.FindStringSubmatch(line); sm != nil {
+		ordered := !strings.ContainsAny(sm[2][:1], "-*+")
+		if p.list == nil || p.list.ordered != ordered {
+			p.flush()
+			p.list = &block{kind: listBlock, ordered: ordered}
+		}
+		p.list.items = append(p.list.items, sm[3])
+		p.indent = len(sm[1]) + len(sm[2]) + 1
+		return
+	}
+	if p.list != nil {
+		if strings.HasPrefix(line, strings.Repeat(" ", p.indent)) {
+			p.list.items[len(p.list.items)-1] += "\n" + strings.TrimSpace(line)
+			return
+		}
+		p.flush()
+	}
+	p.lines = append(p.lines, strings.TrimSpace(line))
+}
+
+// blank ends the current paragraph. Lists may continue after a blank line.
+func (p *paragraphs) blank() {
+	if len(p.lines) > 0 {
+		p.blocks = append(p.blocks, block{kind: paragraphBlock, text: strings.Join(p.lines, "\n")})
+		p.lines = nil
+	}
+}
+
+// isAdornment reports whether the line is a reStructuredText section
+// adornment: a line of at least three repeated punctuation characters.
+func isAdornment(line string) bool {
+	line = strings.TrimRight(line, " ")
+	if len(line) < 3 || !strings.ContainsRune("=-~^\"'`#*+.:_!$%&,;<>?@\\/|", rune(line[0])) {
+		return false
+	}
+	return strings.Trim(line, line[:1]) == ""
+}
+
+// parseRST parses a reStructuredText document.
+func parseRST(src string) []block {
+	lines := strings.Split(expandTabs(src), "\n")
+	var p paragraphs
+	levels := make(map[string]int) // adornment style to heading level
+	heading := func(style, text string) {
+		level, ok := levels[style]
+		if !ok {
+			level = len(levels) + 1
+			levels[style] = level
+		}
+		p.add(block{kind: headingBlock, level: level, text: text})
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			p.blank()
+
+		case isAdornment(line) && i+2 < len(lines) &&
+			isAdornment(lines[i+2]) && strings.TrimSpace(lines[i+1]) != "":
+			// Heading with overline and underline
+			heading("over"+line[:1], strings.TrimSpace(lines[i+1]))
+			i += 2
+
+		case len(p.lines) == 0 && p.list == nil && i+1 < len(lines) && indentOf(line) == 0 &&
+			isAdornment(lines[i+1]) &&
+			utf8.RuneCountInString(strings.TrimSpace(lines[i+1])) >= utf8.RuneCountInString(trimmed):
+			// Heading with underline only
+			heading(lines[i+1][:1], trimmed)
+			i++
+
+		case strings.HasPrefix(trimmed, ".. code") || strings.HasPrefix(trimmed, ".. sourcecode"):
+			p.flush()
+			var code []string
+			i, code = rstIndented(lines, i+1, indentOf(line), true)
+			p.add(block{kind: codeBlock, text: strings.Join(code, "\n")})
+
+		case strings.HasPrefix(trimmed, ".."):
+			// Comments, directives, targets and substitutions are not rendered
+			p.flush()
+			i, _ = rstIndented(lines, i+1, indentOf(line), false)
+
+		case strings.HasSuffix(trimmed, "::"):
+			// Paragraph followed by a literal block
+			if text := strings.TrimSpace(strings.TrimSuffix(trimmed, "::")); text != "" {
+				if strings.HasSuffix(trimmed, " ::") {
+					p.line(text)
+				} else {
+					p.line(text + ":")
+				}
+			}
+			p.flush()
+			var code []string
+			i, code = rstIndented(lines, i+1, indentOf(line), true)
+			if len(code) > 0 {
+				p.add(block{kind: codeBlock, text: strings.Join(code, "\n")})
+			}
+
+		default:
+			p.line(line)
+		}
+	}
+	p.flush()
+	return p.blocks
+}
+
+// rstIndented returns the lines following lines[i-1] which are indented
+// further than indent, and the index of the last such line. Directive
+// options are skipped if skipOptions is true.
+func rstIndented(lines []string, i, indent int, skipOptions bool) (int, []string) {
+	var body []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) {
+			body = append(body, "")
+			continue
+		}
+		if indentOf(line) <= indent {
+			break
+		}
+		if skipOptions && len(body) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			continue
+		}
+		body = append(body, line)
+	}
+	// Remove the common indentation and surrounding blank lines
+	for len(body) > 0 && body[0] == "" {
+		body = body[1:]
+	}
+	for len(body) > 0 && body[len(body)-1] == "" {
+		body = body[:len(body)-1]
+	}
+	common := -1
+	for _, l := range body {
+		if l != "" && (common < 0 || indentOf(l) < common) {
+			common = indentOf(l)
+		}
+	}
+	for j, l := range body {
+		if l != "" {
+			body[j] = l[common:]
+		}
+	}
+	return i - 1, body
+}
+
+var (
+	rstLinkRx     = regexp.MustCompile("^`([^`<]*?)\\s*<([^`>]+)>`__?")
+	rstCodeRx     = regexp.MustCompile("^``(.+?)``")
+	rstStrongRx   = regexp.MustCompile(`^\*\*(\S(?:.*?\S)?)\*\*`)
+	rstEmphasisRx = regexp.MustCompile(`^\*(\S(?:.*?\S)?)\*`)
+	rstRefRx      = regexp.MustCompile("^`([^`]+)`_{0,2}")
+)
+
+// rstInline renders inline reStructuredText.
+func rstInline(w *writer, s string) {
+	textInline(w, s, func(s string) (int, bool) {
+		switch s[0] {
+		case '`':
+			if sm := rstCodeRx.FindStringSubmatch(s); sm != nil {
+				w.WriteString("<code>")
+				w.escape(sm[1])
+				w.WriteString("</code>")
+				return len(sm[0]), true
+			}
+			if sm := rstLinkRx.FindStringSubmatch(s); sm != nil {
+				text := sm[1]
+				if text == "" {
+					text = sm[2]
+				}
+				w.link(sm[2], func() { w.escape(text) })
+				return len(sm[0]), true
+			}
+			if sm := rstRefRx.FindStringSubmatch(s); sm != nil {
+				// Interpreted text and named references are rendered as
+				// plain text, since their targets are not resolved.
+				w.escape(sm[1])
+				return len(sm[0]), true
+			}
+		case '*':
+			if sm := rstStrongRx.FindStringSubmatch(s); sm != nil {
+				w.WriteString("<strong>")
+				w.escape(sm[1])
+				w.WriteString("</strong>")
+				return len(sm[0]), true
+			}
+			if sm := rstEmphasisRx.FindStringSubmatch(s); sm != nil {
+				w.WriteString("<em>")
+				w.escape(sm[1])
+				w.WriteString("</em>")
+				return len(sm[0]), true
+			}
+		}
+		return 0, false
+	})
+}
+
+// orgHeadingRx matches Org mode headings.
+var orgHeadingRx = regexp.MustCompile(`^(\*+)\s+(.*?)\s*$`)
+
+// parseOrg parses an Org mode document.
+func parseOrg(src string) []block {
+	lines := strings.Split(expandTabs(src), "\n")
+	var p paragraphs
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		upper := strings.ToUpper(trimmed)
+		switch {
+		case trimmed == "":
+			p.blank()
+
+		case orgHeadingRx.MatchString(line):
+			sm := orgHeadingRx.FindStringSubmatch(line)
+			p.add(block{kind: headingBlock, level: len(sm[1]), text: sm[2]})
+
+		case strings.HasPrefix(upper, "#+BEGIN_"):
+			name := strings.Fields(upper[len("#+BEGIN_"):])
+			end := "#+END_"
+			if len(name) > 0 {
+				end += name[0]
+			}
+			var body []string
+			for i++; i < len(lines); i++ {
+				if strings.ToUpper(strings.TrimSpace(lines[i])) == end {
+					break
+				}
+				body = append(body, lines[i])
+			}
+			if len(name) > 0 && (name[0] == "SRC" || name[0] == "EXAMPLE") {
+				p.add(block{kind: codeBlock, text: strings.Join(body, "\n")})
+			} else {
+				// Other blocks, such as quotes, are rendered as their contents
+				p.flush()
+				p.blocks = append(p.blocks, parseOrg(strings.Join(body, "\n"))...)
+			}
+
+		case strings.HasPrefix(trimmed, "#"):
+			// Keywords and comments are not rendered
+			p.flush()
+
+		case trimmed == ":" || strings.HasPrefix(trimmed, ": "):
+			var body []string
+			for ; i < len(lines); i++ {
+				t := strings.TrimSpace(lines[i])
+				if t != ":" && !strings.HasPrefix(t, ": ") {
+					break
+				}
+				body = append(body, strings.TrimPrefix(strings.TrimPrefix(t, ":"), " "))
+			}
+			i--
+			p.add(block{kind: codeBlock, text: strings.Join(body, "\n")})
+
+		default:
+			p.line(line)
+		}
+	}
+	p.flush()
+	return p.blocks
+}
+
+var (
+	orgLinkRx = regexp.MustCompile(`^\[\[([^\]]+)\](?:\[([^\]]+)\])?\]`)
+	orgCodeRx = regexp.MustCompile(`^([=~])(\S(?:.*?\S)?)([=~])(?:[\s.,;:!?'")\]}-]|$)`)
+	orgMarkRx = regexp.MustCompile(`^([*/+_])(\S(?:.*?\S)?)([*/+_])(?:[\s.,;:!?'")\]}-]|$)`)
+)
+
+// orgTags maps Org mode emphasis markers to HTML tags.
+var orgTags = map[string]string{"*": "strong", "/": "em", "+": "del", "_": "u"}
+
+// orgInline renders inline Org mode text.
+func orgInline(w *writer, s string) {
+	textInline(w, s, func(s string) (int, bool) {
+		switch s[0] {
+		case '[':
+			if sm := orgLinkRx.FindStringSubmatch(s); sm != nil {
+				dest := strings.TrimPrefix(sm[1], "file:")
+				text := sm[2]
+				if text == "" {
+					text = sm[1]
+				}
+				w.link(dest, func() { w.escape(text) })
+				return len(sm[0]), true
+			}
+		case '=', '~':
+			if sm := orgCodeRx.FindStringSubmatch(s); sm != nil && sm[1] == sm[3] {
+				w.WriteString("<code>")
+				w.escape(sm[2])
+				w.WriteString("</code>")
+				return len(sm[1]) + len(sm[2]) + len(sm[3]), true
+			}
+		case '*', '/', '+', '_':
+			if sm := orgMarkRx.FindStringSubmatch(s); sm != nil && sm[1] == sm[3] {
+				tag := orgTags[sm[1]]
+				w.WriteString("<" + tag + ">")
+				w.escape(sm[2])
+				w.WriteString("</" + tag + ">")
+				return len(sm[1]) + len(sm[2]) + len(sm[3]), true
+			}
+		}
+		return 0, false
+	})
+}
+
+// textInline renders inline text, calling markup at each position where
+// markup may start. Bare URLs are rendered as links.
+func textInline(w *writer, s string, markup func(string) (int, bool)) {
+	for i := 0; i < len(s); {
+		if i == 0 || !isWordChar(s[i-1]) {
+			if n, ok := markup(s[i:]); ok {
+				i += n
+				continue
+			}
+			if s[i] == 'h' {
+				if loc := bareURLRx.FindStringIndex(s[i:]); loc != nil {
+					u := s[i : i+loc[1]]
+					w.link(u, func() { w.escape(u) })
+					i += loc[1]
+					continue
+				}
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		w.escape(s[i : i+size])
+		i += size
+	}
+}
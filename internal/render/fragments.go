@@ -0,0 +1,70 @@
+package render
+
+import (
+	"go/ast"
+	"go/token"
+	"html/template"
+	"strconv"
+)
+
+// FormatVersion is the version of the HTML fragments rendered for a
+// package. It must be incremented whenever the output of DeclHTML or
+// CodeHTML, the URLs of the links in it, or the keys of the fragments
+// change, so that fragments stored by older versions are rebuilt.
+const FormatVersion = 2
+
+// Fragments holds the HTML pre-rendered for the declarations and examples
+// of a package. Declarations are keyed by [DeclKey], and examples by the
+// position of their code in the file set of the package sources.
+type Fragments struct {
+	Version  int                         `json:"version"`
+	Decls    map[string]template.HTML    `json:"decls"`
+	Examples map[token.Pos]template.HTML `json:"examples"`
+}
+
+// NewFragments returns empty fragments of the current format version.
+func NewFragments() *Fragments {
+	return &Fragments{
+		Version:  FormatVersion,
+		Decls:    make(map[string]template.HTML),
+		Examples: make(map[token.Pos]template.HTML),
+	}
+}
+
+// Current reports whether the fragments were rendered by the current
+// format version.
+func (f *Fragments) Current() bool {
+	return f != nil && f.Version == FormatVersion
+}
+
+// DeclKey returns the key of the fragment of the given declaration.
+// Declarations are identified by their position, and methods also by the
+// name of their receiver type: the declarations of methods promoted from
+// embedded types are synthesized with the position of the original method.
+func DeclKey(decl ast.Decl) string {
+	key := strconv.Itoa(int(decl.Pos()))
+	if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil && len(fn.Recv.List) > 0 {
+		key += ":" + recvTypeName(fn.Recv.List[0].Type)
+	}
+	return key
+}
+
+// recvTypeName returns the name of the receiver type of a method.
+func recvTypeName(typ ast.Expr) string {
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.IndexListExpr:
+			typ = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package render
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestDeclKeyPromoted(t *testing.T) {
+	const src = `package p
+
+type Base struct{}
+
+func (Base) M() {}
+
+func (*Base) PtrM() {}
+
+type T struct {
+	Base
+}
+
+type G[E any] struct {
+	*Base
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := doc.NewFromFiles(fset, []*ast.File{file}, "example.com/p", doc.AllMethods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]string)
+	for _, typ := range pkg.Types {
+		for _, m := range typ.Methods {
+			name := typ.Name + "." + m.Name
+			key := DeclKey(m.Decl)
+			if other, ok := keys[key]; ok {
+				t.Errorf("%s and %s have the same key %q", name, other, key)
+			}
+			keys[key] = name
+		}
+	}
+	// M and PtrM of Base, and the methods promoted to T and G
+	if len(keys) != 6 {
+		t.Errorf("got %d method keys, want 6: %v", len(keys), keys)
+	}
+}
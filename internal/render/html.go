@@ -12,17 +12,22 @@ import (
 	"regexp"
 	"strings"
 	"unicode"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/godoc"
 )
 
-// DocHTML returns an HTML formatting of the Doc.
-func DocHTML(d *comment.Doc) template.HTML {
-	p := &htmlPrinter{}
+// DocHTML returns an HTML formatting of the Doc. Doc links for which broken
+// returns true, and bracketed text which looks like a doc link but could not
+// be resolved, are marked as broken. broken may be nil.
+func DocHTML(d *comment.Doc, broken func(*comment.DocLink) bool) template.HTML {
+	p := &htmlPrinter{broken: broken}
 	return template.HTML(p.HTML(d))
 }
 
 // An htmlPrinter holds the state needed for printing a Doc as HTML.
 type htmlPrinter struct {
-	tight bool
+	tight  bool
+	broken func(*comment.DocLink) bool
 }
 
 // HTML returns an HTML formatting of the Doc.
@@ -113,7 +118,7 @@ func (p *htmlPrinter) text(out *bytes.Buffer, x []comment.Text) {
 	for _, t := range x {
 		switch t := t.(type) {
 		case comment.Plain:
-			p.linkRFCs(out, string(t))
+			p.plain(out, string(t))
 		case comment.Italic:
 			out.WriteString("<i>")
 			p.escape(out, string(t))
@@ -125,6 +130,10 @@ func (p *htmlPrinter) text(out *bytes.Buffer, x []comment.Text) {
 			p.text(out, t.Text)
 			out.WriteString("</a>")
 		case *comment.DocLink:
+			if p.broken != nil && p.broken(t) {
+				p.brokenLink(out, func() { p.text(out, t.Text) })
+				continue
+			}
 			url := t.DefaultURL("")
 			if url != "" {
 				out.WriteString(`<a href="`)
@@ -171,6 +180,24 @@ func (p *htmlPrinter) escape(out *bytes.Buffer, s string) {
 	out.WriteString(s[start:])
 }
 
+// plain prints the plain text s to out, marking unresolved doc links.
+func (p *htmlPrinter) plain(out *bytes.Buffer, s string) {
+	for _, loc := range godoc.FindUnresolvedLinks(s) {
+		p.linkRFCs(out, s[:loc[0]])
+		link := s[loc[0]:loc[1]]
+		p.brokenLink(out, func() { p.escape(out, link) })
+		s = s[loc[1]:]
+	}
+	p.linkRFCs(out, s)
+}
+
+// brokenLink prints a broken doc link to out, with its text printed by text.
+func (p *htmlPrinter) brokenLink(out *bytes.Buffer, text func()) {
+	out.WriteString(`<span class="broken-link" title="Broken doc link">`)
+	text()
+	out.WriteString("</span>")
+}
+
 var (
 	// Regexp for RFCs.
 	rfcRx = regexp.MustCompile(`RFC\s+(\d{3,5})(,?\s+[Ss]ection\s+(\d+(\.\d+)*))?`)
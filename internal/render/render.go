@@ -19,6 +19,8 @@ import (
 	"html/template"
 	"net/url"
 	"strconv"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/godoc"
 )
 
 type annotationKind int16
@@ -40,20 +42,31 @@ const (
 
 	// Link to builtin entity with name Text[Pos:End].
 	builtinAnnotation
+
+	// Anchor for a deprecated field or method, named as for anchorAnnotation.
+	deprecatedAnchorAnnotation
+
+	// Link to the URL specified by Paths[PathIndex].
+	urlAnnotation
 )
 
 type annotation struct {
 	Pos, End  int32
 	Kind      annotationKind
-	PathIndex int16
+	PathIndex int
 }
 
+// A LinkFunc returns the URL of the definition of an identifier, or the
+// empty string if the definition is not known.
+type LinkFunc func(id *ast.Ident) string
+
 // declVisitor modifies a declaration AST for printing and collects annotations.
 type declVisitor struct {
 	annotations []annotation
 	paths       []string
 	pathIndex   map[string]int
 	comments    []*ast.CommentGroup
+	linkURL     LinkFunc
 }
 
 func (v *declVisitor) add(kind annotationKind, importPath string) {
@@ -67,13 +80,18 @@ func (v *declVisitor) add(kind annotationKind, importPath string) {
 			v.pathIndex[importPath] = pathIndex
 		}
 	}
-	v.annotations = append(v.annotations, annotation{Kind: kind, PathIndex: int16(pathIndex)})
+	v.annotations = append(v.annotations, annotation{Kind: kind, PathIndex: pathIndex})
 }
 
 func (v *declVisitor) ignoreName() {
 	v.add(-1, "")
 }
 
+// resolved reports whether the definition of the identifier is known.
+func (v *declVisitor) resolved(id *ast.Ident) bool {
+	return v.linkURL != nil && v.linkURL(id) != ""
+}
+
 func (v *declVisitor) Visit(n ast.Node) ast.Visitor {
 	switch n := n.(type) {
 	case *ast.TypeSpec:
@@ -84,15 +102,17 @@ func (v *declVisitor) Visit(n ast.Node) ast.Visitor {
 		switch n := n.Type.(type) {
 		case *ast.InterfaceType:
 			for _, f := range n.Methods.List {
+				kind := fieldAnchorKind(f)
 				for range f.Names {
-					v.add(anchorAnnotation, "")
+					v.add(kind, "")
 				}
 				ast.Walk(v, f.Type)
 			}
 		case *ast.StructType:
 			for _, f := range n.Fields.List {
+				kind := fieldAnchorKind(f)
 				for range f.Names {
-					v.add(anchorAnnotation, "")
+					v.add(kind, "")
 				}
 				ast.Walk(v, f.Type)
 			}
@@ -122,6 +142,8 @@ func (v *declVisitor) Visit(n ast.Node) ast.Visitor {
 		}
 	case *ast.Ident:
 		switch {
+		case v.resolved(n):
+			v.add(urlAnnotation, v.linkURL(n))
 		case n.Obj == nil && doc.IsPredeclared(n.Name):
 			v.add(builtinAnnotation, "")
 		case n.Obj != nil && ast.IsExported(n.Name):
@@ -134,6 +156,11 @@ func (v *declVisitor) Visit(n ast.Node) ast.Visitor {
 			v.ignoreName()
 		}
 	case *ast.SelectorExpr:
+		if v.resolved(n.Sel) {
+			ast.Walk(v, n.X)
+			v.add(urlAnnotation, v.linkURL(n.Sel))
+			return nil
+		}
 		if x, _ := n.X.(*ast.Ident); x != nil {
 			if obj := x.Obj; obj != nil && obj.Kind == ast.Pkg {
 				if spec, _ := obj.Decl.(*ast.ImportSpec); spec != nil {
@@ -182,6 +209,15 @@ func (v *declVisitor) Visit(n ast.Node) ast.Visitor {
 	return nil
 }
 
+// fieldAnchorKind returns the kind of anchor annotation for the names of the
+// given struct field or interface method.
+func fieldAnchorKind(f *ast.Field) annotationKind {
+	if f.Doc != nil && godoc.IsDeprecated(f.Doc.Text()) {
+		return deprecatedAnchorAnnotation
+	}
+	return anchorAnnotation
+}
+
 func newScanner(src []byte) (*scanner.Scanner, *token.File) {
 	fset := token.NewFileSet()
 	file := fset.AddFile("", fset.Base(), len(src))
@@ -190,9 +226,10 @@ func newScanner(src []byte) (*scanner.Scanner, *token.File) {
 	return s, file
 }
 
-// DeclHTML renders the given decl as HTML.
-func DeclHTML(fset *token.FileSet, decl ast.Decl, typ *doc.Type) (template.HTML, error) {
-	v := &declVisitor{pathIndex: make(map[string]int)}
+// DeclHTML renders the given decl as HTML. Identifiers are linked to the
+// URLs returned by linkURL where known, and to guessed definitions otherwise.
+func DeclHTML(fset *token.FileSet, decl ast.Decl, typ *doc.Type, linkURL LinkFunc) (template.HTML, error) {
+	v := &declVisitor{pathIndex: make(map[string]int), linkURL: linkURL}
 	ast.Walk(v, decl)
 
 	node := &printer.CommentedNode{
@@ -243,17 +280,34 @@ loop:
 	return html(src, annotations, v.paths, typ), nil
 }
 
-// CodeHTML renders the given example code as HTML.
-func CodeHTML(fset *token.FileSet, ex *doc.Example) (template.HTML, error) {
+// CodeHTML renders the given example code as HTML. Identifiers are linked
+// to the URLs returned by linkURL.
+func CodeHTML(fset *token.FileSet, ex *doc.Example, linkURL LinkFunc) (template.HTML, error) {
 	var node any
+	var root ast.Node
 	if ex.Play != nil {
 		node = ex.Play
+		root = ex.Play
 	} else {
 		node = &printer.CommentedNode{
 			Node:     ex.Code,
 			Comments: ex.Comments,
 		}
+		root = ex.Code
 	}
+
+	// Identifiers are printed in the order in which they appear in the AST
+	var idents []*ast.Ident
+	if linkURL != nil {
+		ast.Inspect(root, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				idents = append(idents, id)
+			}
+			return true
+		})
+	}
+	var paths []string
+	pathIndex := make(map[string]int)
 	var buf bytes.Buffer
 	if err := format.Node(&buf, fset, node); err != nil {
 		return "", err
@@ -277,10 +331,36 @@ scanLoop:
 			} else {
 				annotations = append(annotations, annotation{Kind: commentAnnotation, Pos: int32(p), End: int32(e)})
 			}
+		case token.IDENT:
+			if len(idents) == 0 {
+				break
+			}
+			id := idents[0]
+			idents = idents[1:]
+			if id.Name != lit {
+				// Out of sync with the AST; stop linking
+				idents = nil
+				break
+			}
+			if u := linkURL(id); u != "" {
+				i, ok := pathIndex[u]
+				if !ok {
+					i = len(paths)
+					paths = append(paths, u)
+					pathIndex[u] = i
+				}
+				p := file.Offset(pos)
+				annotations = append(annotations, annotation{
+					Kind:      urlAnnotation,
+					Pos:       int32(p),
+					End:       int32(p + len(lit)),
+					PathIndex: i,
+				})
+			}
 		}
 		prevTok = tok
 	}
-	return html(src, annotations, nil, nil), nil
+	return html(src, annotations, paths, nil), nil
 }
 
 var period = []byte{'.'}
@@ -312,17 +392,26 @@ func html(src []byte, annotations []annotation, paths []string, typ *doc.Type) t
 			buf.WriteString(`">`)
 			template.HTMLEscape(&buf, src[a.Pos:a.End])
 			buf.WriteString(`</a>`)
+		case urlAnnotation:
+			buf.WriteString(`<a href="`)
+			template.HTMLEscape(&buf, []byte(paths[a.PathIndex]))
+			buf.WriteString(`">`)
+			template.HTMLEscape(&buf, src[a.Pos:a.End])
+			buf.WriteString(`</a>`)
 		case commentAnnotation:
 			buf.WriteString(`<span class="com">`)
 			template.HTMLEscape(&buf, src[a.Pos:a.End])
 			buf.WriteString(`</span>`)
-		case anchorAnnotation:
+		case anchorAnnotation, deprecatedAnchorAnnotation:
 			buf.WriteString(`<span id="`)
 			if typ != nil {
 				template.HTMLEscape(&buf, []byte(typ.Name))
 				buf.WriteByte('.')
 			}
 			template.HTMLEscape(&buf, src[a.Pos:a.End])
+			if a.Kind == deprecatedAnchorAnnotation {
+				buf.WriteString(`" class="deprecated`)
+			}
 			buf.WriteString(`">`)
 			template.HTMLEscape(&buf, src[a.Pos:a.End])
 			buf.WriteString(`</span>`)
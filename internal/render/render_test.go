@@ -0,0 +1,50 @@
+package render
+
+import (
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestCodeHTMLManyLinks(t *testing.T) {
+	// More links than fit in an int16 index
+	const n = 40000
+	var src strings.Builder
+	src.WriteString("package p\n\nfunc f() {\n\t_ = []int{")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&src, "v%d, len(nil), ", i)
+	}
+	src.WriteString("}\n}\n")
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src.String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := &doc.Example{Code: file.Decls[0].(*ast.FuncDecl).Body}
+	got, err := CodeHTML(fset, ex, func(id *ast.Ident) string {
+		if id.Name == "len" {
+			return "/builtin#len"
+		}
+		if strings.HasPrefix(id.Name, "v") {
+			return "/example.com/p#" + id.Name
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<a href="/example.com/p#v0">v0</a>`,
+		fmt.Sprintf(`<a href="/example.com/p#v%d">v%d</a>`, n-1, n-1),
+		`<a href="/builtin#len">len</a>`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("CodeHTML output does not contain %s", want)
+		}
+	}
+}
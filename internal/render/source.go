@@ -0,0 +1,283 @@
+package render
+
+import (
+	"bytes"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"html/template"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SourceHTML renders the named Go source file as HTML, with syntax
+// highlighting, line anchors, and links from identifiers to their
+// declarations. files holds the contents of the Go source files in the
+// package directory, keyed by name, and is used to resolve identifiers
+// declared in other files of the package. fileURL returns the URL of the
+// given file in the package directory.
+func SourceHTML(name string, files map[string][]byte, fileURL func(string) string) template.HTML {
+	src := bytes.ReplaceAll(files[name], []byte("\r\n"), []byte("\n"))
+	fset := token.NewFileSet()
+	// Render the file even if it has syntax errors
+	f, _ := parser.ParseFile(fset, name, src, parser.ParseComments)
+
+	links := make(map[int]string)
+	if f != nil {
+		sl := &sourceLinker{
+			fset:    fset,
+			decls:   packageDecls(f.Name.Name, name, files),
+			imports: importNames(f),
+			fileURL: fileURL,
+			links:   links,
+		}
+		sl.visit(f)
+	}
+
+	// Avoid rendering an empty last line
+	src = bytes.TrimSuffix(src, []byte("\n"))
+
+	s, file := newScanner(src)
+	w := &sourceWriter{}
+	w.startLine()
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		var class string
+		switch {
+		case tok == token.COMMENT:
+			class = "com"
+		case tok == token.STRING || tok == token.CHAR:
+			class = "str"
+		case tok.IsKeyword():
+			class = "kw"
+		case tok == token.IDENT:
+		default:
+			continue
+		}
+		p := file.Offset(pos)
+		e := p + len(lit)
+		if e > len(src) {
+			e = len(src)
+		}
+		w.text(src[last:p], "", "")
+		w.text(src[p:e], class, links[p])
+		last = e
+	}
+	w.text(src[last:], "", "")
+	w.endLine()
+	return template.HTML(`<pre class="source">` + w.String() + "</pre>")
+}
+
+// A declPos is the position of a package-level declaration.
+type declPos struct {
+	file string
+	line int
+}
+
+// packageDecls returns the package-level declarations of the given package
+// found in files other than the named file.
+func packageDecls(pkgName, name string, files map[string][]byte) map[string]declPos {
+	decls := make(map[string]declPos)
+	fset := token.NewFileSet()
+	for fname, src := range files {
+		if fname == name {
+			continue
+		}
+		f, err := parser.ParseFile(fset, fname, src, parser.SkipObjectResolution)
+		if err != nil || f.Name.Name != pkgName {
+			continue
+		}
+		add := func(id *ast.Ident) {
+			if id.Name == "_" {
+				return
+			}
+			p := declPos{file: fname, line: fset.Position(id.Pos()).Line}
+			// Prefer the first file by name for deterministic results
+			if d, ok := decls[id.Name]; !ok || fname < d.file {
+				decls[id.Name] = p
+			}
+		}
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					add(decl.Name)
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						add(spec.Name)
+					case *ast.ValueSpec:
+						for _, id := range spec.Names {
+							add(id)
+						}
+					}
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// majorVersionRx matches major version suffixes of import paths, such as
+// "v2" or "yaml.v3".
+var majorVersionRx = regexp.MustCompile(`^v[0-9]+$|\.v[0-9]+$`)
+
+// importNames returns the import paths of the file keyed by the names by
+// which they are referred to. Package names which are not given explicitly
+// are assumed to match the import path.
+func importNames(f *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range f.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		var name string
+		if spec.Name != nil {
+			name = spec.Name.Name
+		} else {
+			elem := path.Base(importPath)
+			if majorVersionRx.MatchString(elem) && path.Dir(importPath) != "." {
+				if strings.HasPrefix(elem, "v") {
+					elem = path.Base(path.Dir(importPath))
+				} else {
+					elem = elem[:strings.LastIndex(elem, ".v")]
+				}
+			}
+			name = strings.TrimPrefix(elem, "go-")
+		}
+		if name != "_" && name != "." {
+			imports[name] = importPath
+		}
+	}
+	return imports
+}
+
+// sourceLinker computes the links for the identifiers of a source file.
+type sourceLinker struct {
+	fset    *token.FileSet
+	decls   map[string]declPos
+	imports map[string]string
+	fileURL func(string) string
+	links   map[int]string // file offset of identifier to link
+}
+
+func (sl *sourceLinker) add(id *ast.Ident, link string) {
+	sl.links[sl.fset.Position(id.Pos()).Offset] = link
+}
+
+func (sl *sourceLinker) line(pos token.Pos) string {
+	return "#L" + strconv.Itoa(sl.fset.Position(pos).Line)
+}
+
+func (sl *sourceLinker) visit(f *ast.File) {
+	skip := make(map[*ast.Ident]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			// Field and method names are not resolved
+			skip[n.Sel] = true
+			if x, ok := n.X.(*ast.Ident); ok && x.Obj == nil {
+				if importPath, ok := sl.imports[x.Name]; ok {
+					skip[x] = true
+					sl.add(x, formatPathFrag(importPath, ""))
+					if ast.IsExported(n.Sel.Name) {
+						sl.add(n.Sel, formatPathFrag(importPath, n.Sel.Name))
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if n.Recv != nil {
+				// Method names are not package-level identifiers
+				skip[n.Name] = true
+			}
+		case *ast.CompositeLit:
+			// Keys may be struct field names
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if id, ok := kv.Key.(*ast.Ident); ok && id.Obj == nil {
+						skip[id] = true
+					}
+				}
+			}
+		case *ast.ImportSpec:
+			return false
+		case *ast.Ident:
+			if skip[n] {
+				return false
+			}
+			switch {
+			case n.Obj != nil:
+				if n.Obj.Pos().IsValid() && n.Obj.Pos() != n.Pos() {
+					sl.add(n, sl.line(n.Obj.Pos()))
+				}
+			case n == f.Name:
+			default:
+				if d, ok := sl.decls[n.Name]; ok {
+					sl.add(n, sl.fileURL(d.file)+"#L"+strconv.Itoa(d.line))
+				} else if doc.IsPredeclared(n.Name) {
+					sl.add(n, formatPathFrag("builtin", n.Name))
+				}
+			}
+		}
+		return true
+	})
+}
+
+// sourceWriter writes source code as HTML, one line at a time.
+type sourceWriter struct {
+	bytes.Buffer
+	line int
+}
+
+func (w *sourceWriter) startLine() {
+	w.line++
+	id := "L" + strconv.Itoa(w.line)
+	w.WriteString(`<span class="line" id="` + id + `"><a class="lineno" href="#` + id + `">` +
+		strconv.Itoa(w.line) + "</a>")
+}
+
+func (w *sourceWriter) endLine() {
+	w.WriteString("</span>")
+}
+
+// text writes text with the given class and link. Elements are closed and
+// reopened at line breaks so that each line is a separate element.
+func (w *sourceWriter) text(text []byte, class, link string) {
+	for i, part := range bytes.Split(text, []byte("\n")) {
+		if i > 0 {
+			w.endLine()
+			w.WriteByte('\n')
+			w.startLine()
+		}
+		if len(part) == 0 {
+			continue
+		}
+		if link != "" {
+			w.WriteString(`<a href="`)
+			template.HTMLEscape(w, []byte(link))
+			w.WriteString(`"`)
+			if class != "" {
+				w.WriteString(` class="` + class + `"`)
+			}
+			w.WriteString(">")
+			template.HTMLEscape(w, part)
+			w.WriteString("</a>")
+		} else if class != "" {
+			w.WriteString(`<span class="` + class + `">`)
+			template.HTMLEscape(w, part)
+			w.WriteString("</span>")
+		} else {
+			template.HTMLEscape(w, part)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSourceHTML(t *testing.T) {
+	files := map[string][]byte{
+		"a.go": []byte(`package p
+
+import "example.com/m/v2"
+
+// T is a type.
+type T int
+
+func F(x T) string {
+	return m.Name + helper(x) + string(rune(len("s")))
+}
+`),
+		"b.go": []byte("package p\n\nfunc helper(T) string { return \"\" }\n"),
+	}
+	got := string(SourceHTML("a.go", files, func(name string) string {
+		return "/example.com/p/-/src/" + name
+	}))
+	for _, want := range []string{
+		`<span class="line" id="L1"><a class="lineno" href="#L1">1</a><span class="kw">package</span> p</span>`,
+		`<span class="com">// T is a type.</span>`,
+		`func</span> F(x <a href="#L6">T</a>)`,
+		`<a href="/example.com/m/v2">m</a>.<a href="/example.com/m/v2#Name">Name</a>`,
+		`<a href="/example.com/p/-/src/b.go#L3">helper</a>(<a href="#L8">x</a>)`,
+		`<a href="/builtin#len">len</a>(<span class="str">&#34;s&#34;</span>)`,
+		`id="L10"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("SourceHTML output does not contain %s\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `id="L11"`) {
+		t.Errorf("SourceHTML output contains an empty last line\n%s", got)
+	}
+}
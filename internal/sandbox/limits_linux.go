@@ -0,0 +1,33 @@
+package sandbox
+
+import (
+	"math"
+	"strconv"
+)
+
+// wrap returns the command line which runs the command with the given
+// arguments with the limits. The limits are set by prlimit(1) before it
+// executes the command, so that they apply to it and every process it
+// starts.
+func (l *Limits) wrap(args []string) []string {
+	var opts []string
+	for _, limit := range []struct {
+		option string
+		value  int64
+	}{
+		{"--as", l.Memory},
+		{"--cpu", int64(math.Ceil(l.CPU.Seconds()))},
+		{"--nproc", int64(l.Processes)},
+		{"--fsize", l.FileSize},
+	} {
+		if limit.value > 0 {
+			opts = append(opts, limit.option+"="+strconv.FormatInt(limit.value, 10))
+		}
+	}
+	if len(opts) == 0 {
+		return args
+	}
+	wrapped := append([]string{"prlimit"}, opts...)
+	wrapped = append(wrapped, "--")
+	return append(wrapped, args...)
+}
@@ -0,0 +1,21 @@
+package sandbox
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCommandLimits(t *testing.T) {
+	cmd := &Command{
+		Args:   []string{"sh", "-c", "ulimit -v; ulimit -f"},
+		Limits: Limits{Memory: 1 << 30, FileSize: 1 << 20},
+	}
+	result, err := cmd.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The shell reports limits in kilobytes and blocks of 512 bytes
+	if want := "1048576\n2048\n"; result.Output != want {
+		t.Errorf("got output %q, want %q", result.Output, want)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package sandbox
+
+// wrap returns the arguments unchanged: limits are only enforced on Linux.
+func (l *Limits) wrap(args []string) []string {
+	return args
+}
@@ -0,0 +1,53 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandTimeout(t *testing.T) {
+	// The shell stands for "go run", which waits for the program it started
+	cmd := &Command{
+		Args:    []string{"sh", "-c", "sleep 60 & echo $!; wait"},
+		Timeout: 500 * time.Millisecond,
+	}
+	start := time.Now()
+	result, err := cmd.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.TimedOut {
+		t.Error("command did not time out")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Run took %v", d)
+	}
+	pid := strings.TrimSpace(result.Output)
+	if pid == "" {
+		t.Fatal("no process ID in output")
+	}
+	// The killed program may remain a zombie until it is reaped
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stat, err := os.ReadFile("/proc/" + pid + "/stat")
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, state, _ := bytes.Cut(stat, []byte(") ")); bytes.HasPrefix(state, []byte("Z")) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("program %s still running after the timeout", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
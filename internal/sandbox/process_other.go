@@ -0,0 +1,9 @@
+//go:build !unix
+
+package sandbox
+
+import "os/exec"
+
+// killGroup does nothing: only the command itself is killed when it is
+// canceled.
+func killGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,230 @@
+// Package sandbox runs Go programs, such as documentation examples, in a
+// sandbox.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxOutput is the maximum number of bytes of output retained from each of
+// the standard output and standard error of a program.
+const MaxOutput = 64 * 1024
+
+// A Sandbox runs Go programs.
+type Sandbox interface {
+	// Run runs the program made up of the given files, keyed by name.
+	// Errors in the program are reported in the result; the returned error
+	// is only non-nil if the program could not be run at all.
+	Run(ctx context.Context, files map[string][]byte) (*Result, error)
+}
+
+// Result is the result of running a program.
+type Result struct {
+	Output   string `json:"output"`              // standard output
+	Errors   string `json:"errors,omitempty"`    // standard error
+	ExitCode int    `json:"exit_code"`           // exit code of the command
+	TimedOut bool   `json:"timed_out,omitempty"` // the program was killed
+}
+
+// Command runs programs by executing a command in a temporary directory
+// containing the program files. A go.mod file is created if the program
+// does not provide one.
+//
+// The command is typically "go run ." for local execution, or wraps it in
+// a container or gVisor runtime for isolation. The string "{dir}" in its
+// arguments is replaced with the path of the directory, so that it can be
+// mounted into a container.
+//
+// The command does not inherit the environment of the server. It runs with
+// a temporary home directory, the PATH, GOROOT and Go proxy settings of the
+// server, and GOFLAGS=-mod=mod, so that the go.sum file of programs with
+// dependencies is created as needed. On Unix systems, it runs in a process
+// group of its own, which is killed once the timeout expires.
+type Command struct {
+	Args    []string      // command and arguments
+	Env     []string      // additional environment variables
+	Timeout time.Duration // maximum running time, if non-zero
+
+	// CacheDir is the directory of the Go build and module caches, which
+	// are shared by all runs. If empty, each run starts with empty caches.
+	CacheDir string
+
+	// Limits are the resource limits of the processes of the command.
+	Limits Limits
+}
+
+// Limits are resource limits of the processes run by a command. Zero values
+// mean no limit. They are only enforced on Linux, where the command is run
+// by prlimit(1) from util-linux if any limit is set, and only apply to the
+// processes started by the command itself: a container runtime must be
+// configured with its own limits.
+type Limits struct {
+	Memory    int64         // address space of each process, in bytes
+	CPU       time.Duration // CPU time of each process
+	Processes int           // processes and threads of the user
+	FileSize  int64         // size of each file written, in bytes
+}
+
+// MaxFileSize is the default maximum size of files written by commands,
+// such as compiled programs.
+const MaxFileSize = 256 * 1024 * 1024
+
+// ParseCommand returns a Command for the given command line, which is split
+// into fields on white space. Each process of the command may use as much
+// CPU time as the timeout and write files of up to MaxFileSize bytes.
+func ParseCommand(cmdline string, timeout time.Duration) (*Command, error) {
+	args := strings.Fields(cmdline)
+	if len(args) == 0 {
+		return nil, errors.New("empty sandbox command")
+	}
+	return &Command{
+		Args:    args,
+		Timeout: timeout,
+		Limits: Limits{
+			CPU:      timeout,
+			FileSize: MaxFileSize,
+		},
+	}, nil
+}
+
+// passEnv lists the variables of the server's environment passed on to
+// commands.
+var passEnv = []string{
+	"PATH", "GOROOT",
+	"GOPROXY", "GONOPROXY", "GOSUMDB", "GONOSUMDB", "GOPRIVATE", "GOINSECURE",
+}
+
+// environ returns the environment of the command, given its temporary home
+// directory.
+func (c *Command) environ(home string) []string {
+	cache := c.CacheDir
+	if cache == "" {
+		cache = home
+	}
+	env := []string{
+		"HOME=" + home,
+		"TMPDIR=" + home,
+		"GOCACHE=" + filepath.Join(cache, "build"),
+		"GOMODCACHE=" + filepath.Join(cache, "mod"),
+		"GOPATH=" + filepath.Join(home, "go"),
+		"GOFLAGS=-mod=mod",
+		"GOTOOLCHAIN=local",
+	}
+	for _, key := range passEnv {
+		if v, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+v)
+		}
+	}
+	return append(env, c.Env...)
+}
+
+// Run implements [Sandbox].
+func (c *Command) Run(ctx context.Context, files map[string][]byte) (*Result, error) {
+	tmp, err := os.MkdirTemp("", "gddo-run-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "prog")
+	home := filepath.Join(tmp, "home")
+	for _, d := range []string{dir, home} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := files["go.mod"]; !ok {
+		gomod := []byte("module play.ground\n")
+		if err := os.WriteFile(filepath.Join(dir, "go.mod"), gomod, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	for name, data := range files {
+		if name != filepath.Base(name) {
+			return nil, errors.New("invalid file name " + name)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = strings.ReplaceAll(arg, "{dir}", dir)
+	}
+	args = c.Limits.wrap(args)
+	stdout := &limitedBuffer{max: MaxOutput}
+	stderr := &limitedBuffer{max: MaxOutput}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = c.environ(home)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	killGroup(cmd)
+	// Don't wait for processes which escaped the process group once the
+	// command has been killed
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	result := &Result{
+		Output: stdout.String(),
+		Errors: stderr.String(),
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		result.TimedOut = true
+		result.ExitCode = -1
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		return nil, err
+	}
+	return result, nil
+}
+
+// limitedBuffer is a buffer which discards writes beyond its maximum size.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.max - b.Len(); n < len(p) {
+		if n > 0 {
+			b.Buffer.Write(p[:n])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// OutputMatches reports whether the output of an example matches its
+// expected output, following the rules of go test: leading and trailing
+// space is ignored, and if unordered is true, the order of lines is too.
+func OutputMatches(got, want string, unordered bool) bool {
+	got, want = strings.TrimSpace(got), strings.TrimSpace(want)
+	if unordered {
+		return sortLines(got) == sortLines(want)
+	}
+	return got == want
+}
+
+func sortLines(output string) string {
+	lines := strings.Split(output, "\n")
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
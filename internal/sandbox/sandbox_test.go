@@ -0,0 +1,73 @@
+package sandbox
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCommand(t *testing.T) {
+	cmd := &Command{Args: []string{"sh", "-c", "cat main.go go.mod; echo oops >&2; exit 3"}}
+	result, err := cmd.Run(context.Background(), map[string][]byte{
+		"main.go": []byte("package main\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Result{
+		Output:   "package main\nmodule play.ground\n",
+		Errors:   "oops\n",
+		ExitCode: 3,
+	}
+	if *result != want {
+		t.Errorf("got %+v, want %+v", *result, want)
+	}
+
+	cmd = &Command{Args: []string{"sleep", "10"}, Timeout: 50 * time.Millisecond}
+	result, err = cmd.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.TimedOut {
+		t.Errorf("command did not time out: %+v", *result)
+	}
+
+	if _, err := cmd.Run(context.Background(), map[string][]byte{"../x.go": nil}); err == nil {
+		t.Error("expected error for invalid file name")
+	}
+}
+
+func TestCommandEnviron(t *testing.T) {
+	t.Setenv("GDDO_SECRET", "secret")
+	t.Setenv("GOPROXY", "off")
+	cmd := &Command{
+		Args: []string{"sh", "-c", "echo $GDDO_SECRET $GOPROXY $GOFLAGS $EXTRA"},
+		Env:  []string{"EXTRA=extra"},
+	}
+	result, err := cmd.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "off -mod=mod extra\n"; result.Output != want {
+		t.Errorf("got output %q, want %q", result.Output, want)
+	}
+}
+
+func TestOutputMatches(t *testing.T) {
+	for _, test := range []struct {
+		got, want string
+		unordered bool
+		match     bool
+	}{
+		{"hello\n", "hello", false, true},
+		{"hello\n", "goodbye", false, false},
+		{"a\nb\n", "b\na", false, false},
+		{"a\nb\n", "b\na", true, true},
+		{"a\nb\nb\n", "b\na", true, false},
+	} {
+		if match := OutputMatches(test.got, test.want, test.unordered); match != test.match {
+			t.Errorf("OutputMatches(%q, %q, %v) = %v, want %v",
+				test.got, test.want, test.unordered, match, test.match)
+		}
+	}
+}
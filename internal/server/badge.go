@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/badge"
+	"git.sr.ht/~sircmpwn/gddo/internal/httputil"
+)
+
+// notFoundBadgeMaxAge is how long clients may cache badges of packages
+// which are not in the database.
+const notFoundBadgeMaxAge = time.Minute
+
+// serveBadge serves a status badge for the package. kind selects the badge:
+// "version" shows the version of the package, "deprecated" whether its
+// module is deprecated, and "reference" or the empty string a link to its
+// documentation. Packages which are not in the database are not fetched.
+func (s *Server) serveBadge(resp http.ResponseWriter, req *http.Request, platform, importPath, version, kind string) error {
+	var b badge.Badge
+	switch kind {
+	case "", "reference":
+		b = badge.Badge{Label: strings.ToLower(s.cfg.BrandName), Message: "reference", Color: badge.Blue}
+	case "version":
+		b = badge.Badge{Label: "version", Color: badge.Blue}
+	case "deprecated":
+		b = badge.Badge{Label: "status", Message: "active", Color: badge.Green}
+	default:
+		return ErrInvalidBadge
+	}
+
+	dpkg, err := s.db.Package(req.Context(), platform, importPath, version)
+	if err != nil {
+		return err
+	}
+	maxAge := latestMaxAge
+	switch {
+	case dpkg == nil:
+		b.Message, b.Color = "not found", badge.LightGrey
+		maxAge = notFoundBadgeMaxAge
+	case kind == "version":
+		b.Message = dpkg.Version
+		if dpkg.IsRetracted(dpkg.Version) {
+			b.Message += " (retracted)"
+			b.Color = badge.Orange
+		}
+	case kind == "deprecated" && dpkg.Deprecated != "":
+		b.Message, b.Color = "deprecated", badge.Red
+	}
+
+	svg := b.SVG()
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum(svg))
+	h := resp.Header()
+	h.Set("Content-Type", "image/svg+xml")
+	h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge/time.Second))
+	h.Set("Etag", etag)
+	if httputil.CheckNotModified(resp, req, etag, time.Time{}) {
+		return nil
+	}
+	_, err = resp.Write(svg)
+	return err
+}
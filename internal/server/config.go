@@ -2,7 +2,9 @@ package server
 
 import (
 	"flag"
+	"os"
 	"path"
+	"path/filepath"
 	"runtime"
 	"time"
 )
@@ -23,10 +25,36 @@ type Config struct {
 	RequestTimeout  time.Duration
 	RefreshInterval time.Duration
 	MaxAge          time.Duration
+	RequireLicense  bool
+	CheckExamples   bool
+	PlaygroundURL   string
+	PlaygroundView  string
+	RunCommand      string
+	RunTimeout      time.Duration
+	RunCacheDir     string
+	RunMemory       int
+	RunProcesses    int
+	RunConcurrency  int
+	CacheSize       int
+	CacheTTL        time.Duration
+	CacheDir        string
+	Webhooks        string
+	HookSecret      string
+	FetchRate       float64
+	FetchBurst      int
+	RefreshRate     float64
+	RefreshBurst    int
+	TrustedProxies  string
+	LogLevel        string
+	LogFormat       string
 }
 
 func (c *Config) FlagSet() *flag.FlagSet {
 	defaultPlatform := path.Join(runtime.GOOS, runtime.GOARCH)
+	defaultRunCacheDir := ""
+	if dir, err := os.UserCacheDir(); err == nil {
+		defaultRunCacheDir = filepath.Join(dir, "gddo", "run")
+	}
 
 	flags := flag.NewFlagSet("default", flag.ExitOnError)
 	flags.StringVar(&c.BrandName, "brand-name", "GoDoc", "Brand name to use in templates")
@@ -42,5 +70,27 @@ func (c *Config) FlagSet() *flag.FlagSet {
 	flags.DurationVar(&c.RequestTimeout, "request-timeout", 20*time.Second, "Timeout for roundtripping an HTTP request")
 	flags.DurationVar(&c.RefreshInterval, "refresh-interval", 0, "Time to sleep between refreshing modules in the background. Zero disables background refreshing.")
 	flags.DurationVar(&c.MaxAge, "max-age", 24*time.Hour, "Refresh modules that haven't been updated for more than this age")
+	flags.BoolVar(&c.RequireLicense, "require-license", false, "Only display documentation for packages with a recognized license")
+	flags.BoolVar(&c.CheckExamples, "check-examples", false, "Check the examples of fetched packages and report problems with them")
+	flags.StringVar(&c.PlaygroundURL, "playground", "https://play.golang.org", "Go playground used to share examples. Empty disables sharing examples.")
+	flags.StringVar(&c.PlaygroundView, "playground-view", "", "URL template for viewing examples shared with the playground, in which {id} is replaced with the snippet ID. Defaults to the /p/{id} path of the playground.")
+	flags.StringVar(&c.RunCommand, "run-command", "", "Command to run examples with, in a directory containing the example program. Empty disables running examples.")
+	flags.DurationVar(&c.RunTimeout, "run-timeout", 10*time.Second, "Timeout for running examples")
+	flags.StringVar(&c.RunCacheDir, "run-cache-dir", defaultRunCacheDir, "Directory of the Go build and module caches shared by example runs. Empty gives each run empty caches.")
+	flags.IntVar(&c.RunMemory, "run-memory", 1024, "Memory limit of each process running an example in megabytes. Zero disables the limit.")
+	flags.IntVar(&c.RunProcesses, "run-processes", 1024, "Limit of the processes and threads of the user running examples. Zero disables the limit.")
+	flags.IntVar(&c.RunConcurrency, "run-concurrency", 4, "Maximum number of examples run at the same time")
+	flags.IntVar(&c.CacheSize, "cache-size", 64, "Size of the in-memory cache of rendered pages in megabytes. Zero disables caching.")
+	flags.DurationVar(&c.CacheTTL, "cache-ttl", 10*time.Minute, "Maximum age of cached pages. Zero disables expiry.")
+	flags.StringVar(&c.CacheDir, "cache-dir", "", "Directory of a cache of rendered pages shared with other servers on the host")
+	flags.StringVar(&c.Webhooks, "webhooks", "", "File of webhook subscriptions notified of new versions, deprecations and retractions of modules")
+	flags.StringVar(&c.HookSecret, "hook-secret", "", "Secret authenticating requests to the refresh webhook. Empty disables the webhook.")
+	flags.Float64Var(&c.FetchRate, "fetch-rate", -1, "Number of module fetches and example runs per minute allowed for each client. Zero disables the limit. Defaults to 10 if --trusted-proxies is set, and to no limit otherwise, as the clients of a reverse proxy would share its limit.")
+	flags.IntVar(&c.FetchBurst, "fetch-burst", 20, "Number of module fetches and example runs each client may make in a burst")
+	flags.Float64Var(&c.RefreshRate, "refresh-rate", 2, "Number of refresh form submissions per minute allowed for each client. Zero disables the limit.")
+	flags.IntVar(&c.RefreshBurst, "refresh-burst", 5, "Number of refresh form submissions each client may make in a burst")
+	flags.StringVar(&c.TrustedProxies, "trusted-proxies", "", "Comma-separated addresses and CIDR prefixes of reverse proxies trusted to set the X-Forwarded-For header")
+	flags.StringVar(&c.LogLevel, "log-level", "info", "Minimum level of logged messages: debug, info, warn or error")
+	flags.StringVar(&c.LogFormat, "log-format", "text", "Format of logged messages: text or json")
 	return flags
 }
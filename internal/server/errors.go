@@ -1,13 +1,13 @@
 package server
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"runtime/debug"
+	"time"
 
 	"git.sr.ht/~sircmpwn/gddo/internal"
 )
@@ -16,8 +16,10 @@ var (
 	ErrBlocked    = errors.New("blocked import path")
 	ErrNoPackages = errors.New("no packages found")
 	ErrFetching   = errors.New("fetch in progress")
+	ErrBusy       = errors.New("too many examples running")
 
 	ErrInvalidPlatform = errors.New("invalid platform")
+	ErrInvalidBadge    = errors.New("invalid badge")
 )
 
 // ErrMismatch represents the case where the import path is different from the
@@ -31,12 +33,27 @@ func (e ErrMismatch) Error() string {
 	return fmt.Sprintf("import paths don't match: expected %q, got %q", e.ExpectedPath, e.ActualPath)
 }
 
+// ErrRateLimited represents the case where a client exceeded a rate limit.
+type ErrRateLimited struct {
+	// The time after which the client may try again.
+	RetryAfter time.Duration
+}
+
+func (e ErrRateLimited) Error() string {
+	return "rate limit exceeded"
+}
+
 func shouldDisplayError(err error) bool {
 	return !errors.Is(err, ErrBlocked) && !errors.Is(err, internal.ErrNotFound)
 }
 
 func errorMessage(err error) (string, int) {
+	var limited ErrRateLimited
 	switch {
+	case errors.As(err, &limited):
+		return "Too many requests. Please try again later.", http.StatusTooManyRequests
+	case errors.Is(err, ErrBusy):
+		return "Too many examples are running. Please try again later.", http.StatusServiceUnavailable
 	case errors.Is(err, ErrFetching):
 		return "This package is being fetched in the background. Feel free to refresh while we're working on it.", http.StatusNotFound
 	case errors.Is(err, ErrNoPackages):
@@ -47,6 +64,8 @@ func errorMessage(err error) (string, int) {
 		return "Error fetching module: Invalid version.", http.StatusNotFound
 	case errors.Is(err, ErrInvalidPlatform):
 		return "Error fetching module: Invalid platform.", http.StatusNotFound
+	case errors.Is(err, ErrInvalidBadge):
+		return "Invalid badge. Supported badges are reference, version and deprecated.", http.StatusNotFound
 	case errors.Is(err, internal.ErrTooLarge):
 		return fmt.Sprintf("Error fetching module: The requested module exceeds the maximum module size of %dMB.", MaxFileSize/(1000*1000)), http.StatusNotFound
 	case errors.Is(err, internal.ErrNotFound), errors.Is(err, ErrBlocked):
@@ -56,10 +75,7 @@ func errorMessage(err error) (string, int) {
 	return "Internal server error.", http.StatusInternalServerError
 }
 
-func logPanic(url *url.URL, rv interface{}) {
-	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "Error serving %s: handler panic\n", url)
-	fmt.Fprintln(&buf, rv)
-	buf.Write(debug.Stack())
-	log.Print(buf.String())
+func logPanic(log *slog.Logger, url *url.URL, rv interface{}) {
+	log.Error("handler panic", "url", url.String(), "panic", fmt.Sprint(rv),
+		"stack", string(debug.Stack()))
 }
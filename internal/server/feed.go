@@ -0,0 +1,321 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/database"
+	"git.sr.ht/~sircmpwn/gddo/internal/godoc"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// maxFeedEntries is the maximum number of entries of a feed.
+	maxFeedEntries = 50
+	// maxSummaryNames is the maximum number of declarations listed for
+	// each kind of change to a package in a feed entry.
+	maxSummaryNames = 10
+	// feedTTL is the time for which the versions listed in the feed of a
+	// package are cached.
+	feedTTL = 10 * time.Minute
+	// maxCachedFeeds is the maximum number of packages whose feed versions
+	// are cached.
+	maxCachedFeeds = 10000
+)
+
+// An atomFeed is an Atom feed, as specified by RFC 4287.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary,omitempty"`
+}
+
+// writeFeed writes the feed as an Atom document.
+func writeFeed(resp http.ResponseWriter, feed *atomFeed) error {
+	resp.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	io.WriteString(resp, xml.Header)
+	enc := xml.NewEncoder(resp)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(resp, "\n")
+	return err
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// serveFeed serves an Atom feed of the versions of the module of the
+// package, with a summary of the changes to its exported API where they are
+// known. The API of a module is summarized for all of its packages.
+func (s *Server) serveFeed(resp http.ResponseWriter, req *http.Request, pkg *Package) error {
+	versions, err := s.feedVersions(req.Context(), pkg)
+	if err != nil {
+		return err
+	}
+
+	root := getRootURL(req)
+	self := root + "/" + pkg.ImportPath + "?view=feed"
+	feed := &atomFeed{
+		Title:  pkg.ImportPath + " versions - " + s.cfg.BrandName,
+		ID:     self,
+		Author: atomPerson{Name: s.cfg.BrandName},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: self},
+			{Rel: "alternate", Type: "text/html", Href: root + "/" + pkg.ImportPath + "?view=versions"},
+		},
+	}
+	var updated time.Time
+	for _, v := range versions {
+		if v.CommitTime.After(updated) {
+			updated = v.CommitTime
+		}
+		summary := v.Summary
+		if r := pkg.Retraction(v.Version); r != nil {
+			summary = append([]string{"Retracted: " + r.Rationale}, summary...)
+		}
+		link := root + "/" + pkg.ImportPath + "@" + v.Version
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   pkg.ImportPath + " " + v.Version,
+			ID:      link,
+			Updated: atomTime(v.CommitTime),
+			Link:    atomLink{Rel: "alternate", Href: link},
+			Summary: strings.Join(summary, "\n"),
+		})
+	}
+	if updated.IsZero() {
+		updated = pkg.Updated
+	}
+	feed.Updated = atomTime(updated)
+	return writeFeed(resp, feed)
+}
+
+// A feedVersion is a version of a package listed in its feed.
+type feedVersion struct {
+	Version    string
+	CommitTime time.Time
+	Summary    []string // changes to the exported API
+}
+
+// unfetchedSummary is the summary of versions which have not been fetched.
+const unfetchedSummary = "This version has not been fetched yet."
+
+type feedKey struct {
+	platform, importPath string
+	// The time the module was last updated, which changes when versions
+	// are added
+	updated time.Time
+}
+
+// feedVersions returns the newest maxFeedEntries versions of the module of
+// the package, newest first: the versions listed by its source and those
+// fetched. They are computed from the APIs of the packages of many versions
+// of the module, so they are cached.
+//
+// The commit times of versions which have not been fetched are unknown, and
+// fetching them from the module source for every feed would be too costly,
+// so the time the module was last updated is used for them instead, which
+// is when their versions were last listed.
+func (s *Server) feedVersions(ctx context.Context, pkg *Package) ([]feedVersion, error) {
+	key := feedKey{pkg.Platform, pkg.ImportPath, pkg.Updated}
+	if versions, ok := s.feedCache.Get(key); ok {
+		return versions, nil
+	}
+
+	// The version after the last entry is loaded to summarize its changes
+	history, err := s.db.ModuleVersions(ctx, pkg.Platform, pkg.ModulePath, maxFeedEntries+1)
+	if err != nil {
+		return nil, err
+	}
+	only := pkg.ImportPath
+	if pkg.ImportPath == pkg.ModulePath {
+		only = ""
+	}
+	fetched := make(map[string]int) // indexes in history
+	list := append([]string(nil), pkg.Versions...)
+	for i, v := range history {
+		fetched[v.Version] = i
+		if !slices.Contains(list, v.Version) {
+			// Pseudo-versions are not listed
+			list = append(list, v.Version)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return semver.Compare(list[i], list[j]) > 0
+	})
+	if len(list) > maxFeedEntries {
+		list = list[:maxFeedEntries]
+	}
+
+	var versions []feedVersion
+	for _, version := range list {
+		i, ok := fetched[version]
+		if !ok {
+			versions = append(versions, feedVersion{
+				Version:    version,
+				CommitTime: pkg.Updated,
+				Summary:    []string{unfetchedSummary},
+			})
+			continue
+		}
+		v := history[i]
+		fv := feedVersion{Version: v.Version, CommitTime: v.CommitTime}
+		if v.APIs != nil {
+			// Compare with the previous version whose API is known
+			for _, prev := range history[i+1:] {
+				if prev.APIs != nil {
+					fv.Summary = append(fv.Summary, "Changes since "+prev.Version+":")
+					fv.Summary = append(fv.Summary, apiSummary(prev.APIs, v.APIs, only)...)
+					break
+				}
+			}
+		}
+		versions = append(versions, fv)
+	}
+
+	s.feedCache.Put(key, versions)
+	return versions, nil
+}
+
+// apiSummary describes the changes from the APIs of the packages of one
+// version of a module to those of another, keyed by import path. If only is
+// not empty, only the changes to that package are described.
+func apiSummary(old, cur map[string]godoc.API, only string) []string {
+	paths := make(map[string]bool)
+	for path := range old {
+		paths[path] = true
+	}
+	for path := range cur {
+		paths[path] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		if only == "" || path == only {
+			sorted = append(sorted, path)
+		}
+	}
+	sort.Strings(sorted)
+
+	var lines []string
+	for _, path := range sorted {
+		prev, inOld := old[path]
+		api, inCur := cur[path]
+		switch {
+		case !inOld:
+			lines = append(lines, "New package "+path)
+		case !inCur:
+			lines = append(lines, "Removed package "+path)
+		default:
+			d := api.Diff(prev)
+			if d.Empty() {
+				continue
+			}
+			var changes []string
+			for _, c := range []struct {
+				verb  string
+				names []string
+			}{{"added", d.Added}, {"changed", d.Changed}, {"removed", d.Removed}} {
+				if len(c.names) > 0 {
+					changes = append(changes, c.verb+" "+nameList(c.names))
+				}
+			}
+			lines = append(lines, path+": "+strings.Join(changes, "; "))
+		}
+	}
+	if len(lines) == 0 {
+		return []string{"No changes to the exported API."}
+	}
+	return lines
+}
+
+// nameList formats a list of declaration names, abbreviating long lists.
+func nameList(names []string) string {
+	if len(names) <= maxSummaryNames {
+		return strings.Join(names, ", ")
+	}
+	return strings.Join(names[:maxSummaryNames], ", ") + " and " +
+		strconv.Itoa(len(names)-maxSummaryNames) + " more"
+}
+
+// serveSiteFeed serves an Atom feed of the most recently indexed module
+// versions.
+func (s *Server) serveSiteFeed(resp http.ResponseWriter, req *http.Request) error {
+	modules, err := s.db.RecentModules(req.Context(), s.cfg.Platform, maxFeedEntries)
+	if err != nil {
+		return err
+	}
+
+	root := getRootURL(req)
+	self := root + "/-/feed"
+	feed := &atomFeed{
+		Title:  "Recently indexed modules - " + s.cfg.BrandName,
+		ID:     self,
+		Author: atomPerson{Name: s.cfg.BrandName},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: self},
+			{Rel: "alternate", Type: "text/html", Href: root + "/"},
+		},
+	}
+	updated := time.Now()
+	if len(modules) > 0 {
+		updated = modules[0].Created
+	}
+	feed.Updated = atomTime(updated)
+	for _, mod := range modules {
+		feed.Entries = append(feed.Entries, recentEntry(root, mod))
+	}
+
+	resp.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", latestMaxAge/time.Second))
+	resp.Header().Set("Vary", "X-Forwarded-Proto")
+	return writeFeed(resp, feed)
+}
+
+func recentEntry(root string, mod database.RecentModule) atomEntry {
+	link := root + "/" + mod.ModulePath + "@" + mod.Version
+	summary := mod.Synopsis
+	if !mod.CommitTime.IsZero() {
+		if summary != "" {
+			summary += "\n"
+		}
+		summary += "Committed " + atomTime(mod.CommitTime)
+	}
+	return atomEntry{
+		Title:   mod.ModulePath + " " + mod.Version,
+		ID:      link,
+		Updated: atomTime(mod.Created),
+		Link:    atomLink{Rel: "alternate", Href: link},
+		Summary: summary,
+	}
+}
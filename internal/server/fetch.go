@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
 	"path"
 	"sort"
 	"time"
@@ -12,17 +11,88 @@ import (
 	"git.sr.ht/~sircmpwn/gddo/internal"
 	"git.sr.ht/~sircmpwn/gddo/internal/autodiscovery"
 	"git.sr.ht/~sircmpwn/gddo/internal/godoc"
+	"git.sr.ht/~sircmpwn/gddo/internal/licenses"
 	"git.sr.ht/~sircmpwn/gddo/internal/proxy"
+	"git.sr.ht/~sircmpwn/gddo/internal/readme"
 	"git.sr.ht/~sircmpwn/gddo/internal/stdlib"
+	"git.sr.ht/~sircmpwn/gddo/internal/webhook"
 	"golang.org/x/mod/semver"
 )
 
 const (
 	// MaxFileSize is the maximum file size that is allowed for reading.
 	MaxFileSize = 30 * megabyte
-	megabyte    = 1000 * 1000
+	// MaxSourceFileSize is the maximum size of a source file that is
+	// stored for display.
+	MaxSourceFileSize = 1 * megabyte
+	megabyte          = 1000 * 1000
+
+	// maxLinkedFetches is the maximum number of packages linked from the
+	// documentation of a module which are fetched in the background.
+	maxLinkedFetches = 10
 )
 
+var errTooManyFetches = errors.New("too many fetches")
+
+type linkedContextKey struct{}
+
+// withLinked returns a context marking fetches of packages linked from the
+// documentation of another module.
+func withLinked(ctx context.Context) context.Context {
+	return context.WithValue(ctx, linkedContextKey{}, true)
+}
+
+// isLinked reports whether ctx belongs to a fetch of a linked package.
+func isLinked(ctx context.Context) bool {
+	linked, _ := ctx.Value(linkedContextKey{}).(bool)
+	return linked
+}
+
+// fetchFailures lists the errors of failed fetches which are remembered,
+// so that requests for the same import path do not make gddo walk its
+// parent paths in the module proxy again. Each error is stored as a reason
+// and remembered for the ttl.
+var fetchFailures = []struct {
+	err    error
+	reason string
+	ttl    time.Duration
+}{
+	{internal.ErrNotFound, "not found", time.Hour},
+	{internal.ErrBadModule, "bad module", time.Hour},
+	{internal.ErrTooLarge, "too large", 24 * time.Hour},
+	{ErrNoPackages, "no packages", 6 * time.Hour},
+	{proxy.ErrProxyTimedOut, "proxy timed out", 5 * time.Minute},
+}
+
+// rememberFailure stores the failure to fetch the import path, if its error
+// is one of fetchFailures.
+func (s *Server) rememberFailure(ctx context.Context, platform, importPath, version string, err error) {
+	for _, f := range fetchFailures {
+		if errors.Is(err, f.err) {
+			if err := s.db.PutFetchFailure(ctx, platform, importPath, version, f.reason, f.ttl); err != nil {
+				logger(ctx).Error("error storing failed fetch", "import_path", importPath, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// checkFailure returns the error of a remembered failure to fetch the
+// import path, if any.
+func (s *Server) checkFailure(ctx context.Context, platform, importPath, version string) error {
+	reason, err := s.db.FetchFailure(ctx, platform, importPath, version)
+	if err != nil || reason == "" {
+		return err
+	}
+	for _, f := range fetchFailures {
+		if f.reason == reason {
+			s.metrics.fetchFailureHits.Inc()
+			return f.err
+		}
+	}
+	return nil
+}
+
 // fetch fetches package documentation from the module proxy and updates the database.
 func (s *Server) fetch(ctx context.Context, platform, importPath, version string) error {
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.FetchTimeout)
@@ -41,33 +111,30 @@ func (s *Server) fetch(ctx context.Context, platform, importPath, version string
 		return ErrBlocked
 	}
 
-	// Limit concurrent module fetches.
+	// Check if the fetch failed recently
+	if err := s.checkFailure(ctx, platform, importPath, version); err != nil {
+		return err
+	}
+
+	// Limit concurrent module fetches. Fetches of linked packages have
+	// their own limit, so that they don't hold up requested fetches.
+	sem := s.moduleFetchSem
+	if isLinked(ctx) {
+		sem = s.linkedFetchSem
+	}
 	select {
-	case s.moduleFetchSem <- struct{}{}:
+	case sem <- struct{}{}:
 	default:
-		return errors.New("too many fetches")
+		return errTooManyFetches
 	}
-	defer func() { <-s.moduleFetchSem }()
+	defer func() { <-sem }()
 
 	ch := make(chan error, 1)
 	go func() {
-		ctx := context.Background()
-		// Special case for stdlib packages
-		if stdlib.Contains(importPath) {
-			ch <- s.fetchModule(ctx, platform, proxy.StdlibModulePath, version)
-			return
-		}
-		// Loop through potential module paths
-		for modulePath := importPath; modulePath != "."; modulePath = path.Dir(modulePath) {
-			err := s.fetchModule(ctx, platform, modulePath, version)
-			if errors.Is(err, internal.ErrNotFound) || errors.Is(err, internal.ErrInvalidPath) {
-				// Try parent path
-				continue
-			}
-			ch <- err
-			return
-		}
-		ch <- internal.ErrNotFound
+		ctx := detach(ctx)
+		err := s.fetchModules(ctx, platform, importPath, version)
+		s.rememberFailure(ctx, platform, importPath, version, err)
+		ch <- err
 	}()
 
 	select {
@@ -78,6 +145,24 @@ func (s *Server) fetch(ctx context.Context, platform, importPath, version string
 	}
 }
 
+// fetchModules fetches the module providing the import path.
+func (s *Server) fetchModules(ctx context.Context, platform, importPath, version string) error {
+	// Special case for stdlib packages
+	if stdlib.Contains(importPath) {
+		return s.fetchModule(ctx, platform, proxy.StdlibModulePath, version)
+	}
+	// Loop through potential module paths
+	for modulePath := importPath; modulePath != "."; modulePath = path.Dir(modulePath) {
+		err := s.fetchModule(ctx, platform, modulePath, version)
+		if errors.Is(err, internal.ErrNotFound) || errors.Is(err, internal.ErrInvalidPath) {
+			// Try parent path
+			continue
+		}
+		return err
+	}
+	return internal.ErrNotFound
+}
+
 func (s *Server) fetchModule(ctx context.Context, platform, modulePath, version string) error {
 	type fetchKey struct {
 		platform, modulePath, version string
@@ -93,33 +178,66 @@ func (s *Server) fetchModule(ctx context.Context, platform, modulePath, version
 	s.metrics.fetchesActive.Inc()
 	defer s.metrics.fetchesActive.Dec()
 
-	if err := s.fetchModule_(ctx, platform, modulePath, version); err != nil {
-		if !errors.Is(err, internal.ErrNotFound) {
+	log := logger(ctx).With("fetch_id", newID(), "module", modulePath,
+		"version", version, "platform", platform)
+	ctx = withLogger(ctx, log)
+	start := time.Now()
+	stats, err := s.fetchModule_(ctx, platform, modulePath, version)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) || errors.Is(err, internal.ErrInvalidPath) {
+			// Parent paths of import paths are tried in turn
+			log.Debug("module not found", "duration", time.Since(start))
+		} else {
 			s.metrics.fetchErrorsTotal.Inc()
+			log.Warn("error fetching module", "error", err, "duration", time.Since(start))
 		}
 		return err
 	}
+	if stats == nil {
+		// The packages were already stored
+		log.Debug("fetch finished", "duration", time.Since(start))
+		return nil
+	}
+	log.Info("fetch finished", "resolved_version", stats.version,
+		"zip_bytes", stats.zipSize, "packages", stats.packages,
+		"source_files", stats.sourceFiles, "source_bytes", stats.sourceSize,
+		"load_duration", stats.loadDuration, "check_duration", stats.checkDuration,
+		"store_duration", stats.storeDuration, "duration", time.Since(start))
 	return nil
 }
 
-func (s *Server) fetchModule_(ctx context.Context, platform, modulePath, version string) error {
+// fetchStats describes the module version stored by a fetch.
+type fetchStats struct {
+	version       string // resolved version
+	zipSize       int64
+	packages      int
+	sourceFiles   int
+	sourceSize    int
+	loadDuration  time.Duration
+	checkDuration time.Duration
+	storeDuration time.Duration
+}
+
+// fetchModule_ fetches the module version and stores its packages. The
+// returned stats are nil if the packages were already stored.
+func (s *Server) fetchModule_(ctx context.Context, platform, modulePath, version string) (*fetchStats, error) {
 	// Update the module timestamp.
 	// We do this before returning any errors so that background refreshes
 	// won't get stuck fetching the same broken module over and over.
 	// Note that this does nothing if the module is not present in the database.
 	if err := s.db.TouchModule(ctx, modulePath); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Retrieve module
 	source, mod, err := s.sources.FindModule(modulePath, version)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if mod.ModulePath != modulePath {
 		// The module paths don't match
-		return ErrMismatch{
+		return nil, ErrMismatch{
 			ExpectedPath: modulePath,
 			ActualPath:   mod.ModulePath,
 		}
@@ -130,60 +248,198 @@ func (s *Server) fetchModule_(ctx context.Context, platform, modulePath, version
 		return semver.Compare(mod.Versions[i], mod.Versions[j]) > 0
 	})
 
-	if err := s.db.PutModule(ctx, mod); err != nil {
-		return err
+	// Subscribers are notified once the packages of the module are stored,
+	// so the events are queued until then, even if this fetch fails
+	var changes func(prev *internal.Module) []webhook.Event
+	if s.webhooks != nil {
+		changes = func(prev *internal.Module) []webhook.Event {
+			return webhook.Changes(prev, mod)
+		}
 	}
+	if err := s.db.PutModule(ctx, mod, changes); err != nil {
+		return nil, err
+	}
+	// The latest version and the version list may have changed
+	s.cache.Invalidate(modulePath)
 
 	// Update project information
 	lastUpdated, err := s.db.ProjectUpdated(ctx, modulePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if time.Since(lastUpdated) > 5*time.Minute {
 		project, err := autodiscovery.Fetch(ctx, s.httpClient, mod.SeriesPath, s.cfg.UserAgent)
 		if err != nil {
-			log.Printf("Error fetching project information for %s: %v", modulePath, err)
+			logger(ctx).Warn("error fetching project information", "error", err)
 		}
 		if project != nil {
 			if err := s.db.PutProject(ctx, modulePath, project); err != nil {
-				return err
+				return nil, err
 			}
+			s.cache.Invalidate(modulePath)
 		}
 	}
 
 	// If the packages are already in the database, return
 	if ok, err := s.db.HasPackage(ctx, platform, modulePath, mod.Version); err != nil {
-		return err
+		return nil, err
 	} else if ok {
-		return nil
+		s.dispatchEvents(ctx, modulePath)
+		return nil, nil
 	}
 
 	// Retrieve packages
-	log.Printf("FETCH %s@%s %s", modulePath, mod.Version, platform)
+	log := logger(ctx).With("resolved_version", mod.Version)
+	log.Info("fetching module")
+	start := time.Now()
 	fsys, err := source.Files(mod)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	pkgs, err := loadPackages(platform, modulePath, fsys)
+	pkgs, err := loadPackages(log, platform, modulePath, fsys)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if len(pkgs) == 0 {
 		// The module has no packages
-		return ErrNoPackages
+		return nil, ErrNoPackages
+	}
+	// The standard library license is outside of the source tree
+	var lics []*licenses.License
+	if modulePath != proxy.StdlibModulePath {
+		lics, err = licenses.Detect(fsys)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rdme, err := readme.Detect(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if rdme != nil {
+		project, err := s.db.Project(ctx, modulePath)
+		if err != nil {
+			return nil, err
+		}
+		rdme.Rendered = rdme.HTML(readmeResolver(project, mod.Reference))
+	}
+	srcFiles, err := loadSourceFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+	loaded := time.Now()
+	imp := s.newImporter(ctx, platform, pkgs)
+	infos := checkPackages(imp, pkgs)
+	checked := time.Now()
+
+	var linked []string
+	err = s.db.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		if err := s.db.PutLicenses(tx, mod, lics); err != nil {
+			return err
+		}
+		if err := s.db.PutReadme(tx, mod, rdme); err != nil {
+			return err
+		}
+		if err := s.db.PutSourceFiles(tx, mod, srcFiles); err != nil {
+			return err
+		}
+		linked, err = s.putResults(tx, platform, mod, pkgs, imp, infos)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Packages of the module which failed to fetch before may now exist
+	if err := s.db.DeleteFetchFailures(ctx, modulePath); err != nil {
+		return nil, err
+	}
+	stats := &fetchStats{
+		version:       mod.Version,
+		zipSize:       mod.ZipSize,
+		packages:      len(pkgs),
+		sourceFiles:   len(srcFiles),
+		loadDuration:  loaded.Sub(start),
+		checkDuration: checked.Sub(loaded),
+		storeDuration: time.Since(checked),
+	}
+	for _, src := range srcFiles {
+		stats.sourceSize += len(src)
+	}
+	s.cache.Invalidate(modulePath)
+	s.dispatchEvents(ctx, modulePath)
+	// Packages linked from linked packages are fetched when requested
+	if !isLinked(ctx) {
+		s.fetchLinked(ctx, platform, linked)
+	}
+	return stats, nil
+}
+
+// dispatchEvents dispatches the webhook events queued for the module.
+func (s *Server) dispatchEvents(ctx context.Context, modulePath string) {
+	if s.webhooks == nil {
+		return
 	}
+	events, err := s.db.TakeEvents(ctx, modulePath)
+	if err != nil {
+		logger(ctx).Error("error taking webhook events", "module", modulePath, "error", err)
+		return
+	}
+	s.webhooks.Dispatch(events)
+}
+
+// stdlibInterfaces lists the standard library packages whose interfaces are
+// commonly implemented by other packages. Implementations of interfaces from
+// these packages, the packages of the module, and the standard library
+// packages imported by a package are recorded.
+var stdlibInterfaces = []string{
+	"context", "encoding", "encoding/json", "encoding/xml", "flag", "fmt",
+	"hash", "io", "sort",
+}
 
-	return s.db.WithTx(ctx, nil, func(tx *sql.Tx) error {
-		return s.putResults(tx, platform, mod, pkgs)
+// newImporter returns an importer for the loaded packages. Packages outside
+// of the module are loaded from the database.
+func (s *Server) newImporter(ctx context.Context, platform string, pkgs map[string]loadResult) *godoc.Importer {
+	return godoc.NewImporter(func(importPath string) (*godoc.Package, error) {
+		if result, ok := pkgs[importPath]; ok {
+			return result.Package, nil
+		}
+		dpkg, err := s.db.Package(ctx, platform, importPath, internal.LatestVersion)
+		if err != nil || dpkg == nil {
+			return nil, err
+		}
+		return godoc.DecodePackage(dpkg.Source)
 	})
 }
 
-// putResults stores the package load results for a given module in the database.
-func (s *Server) putResults(tx *sql.Tx, platform string, mod *internal.Module, pkgs map[string]loadResult) error {
+// checkPackages type-checks the loaded packages and returns the links of
+// their identifiers, the members promoted to their types, and the interfaces
+// they implement, keyed by import path. Identifiers which refer to packages
+// not yet in the database are left unresolved.
+func checkPackages(imp *godoc.Importer, pkgs map[string]loadResult) map[string]*godoc.Info {
+	infos := make(map[string]*godoc.Info)
+	ifacePaths := append([]string(nil), stdlibInterfaces...)
+	for importPath, result := range pkgs {
+		if result.Package != nil {
+			infos[importPath] = imp.Check(importPath, result.Package)
+			ifacePaths = append(ifacePaths, importPath)
+		}
+	}
+	for importPath, info := range infos {
+		info.Implements = imp.Implements(importPath, ifacePaths)
+	}
+	return infos
+}
+
+// putResults stores the package load results for a given module in the
+// database. It returns the import paths of the packages linked from their
+// documentation which are not yet in the database.
+func (s *Server) putResults(tx *sql.Tx, platform string, mod *internal.Module, pkgs map[string]loadResult, imp *godoc.Importer, infos map[string]*godoc.Info) ([]string, error) {
+	var linked []string
+	seen := make(map[string]bool)
 	for importPath, result := range pkgs {
 		if result.Package == nil {
 			if err := s.db.PutDirectory(tx, platform, mod, importPath, result.Error); err != nil {
-				return err
+				return nil, err
 			}
 			continue
 		}
@@ -192,32 +448,128 @@ func (s *Server) putResults(tx *sql.Tx, platform string, mod *internal.Module, p
 		// doc.New overwrites the AST.
 		source, err := result.Package.Encode()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// TODO: Truncate large packages
 
-		docPkg, err := godoc.BuildDoc(result.Package, importPath)
+		docPkg, err := godoc.BuildDoc(result.Package, importPath, false)
 		if err != nil {
 			// Store the error in the database
 			if err := s.db.PutDirectory(tx, platform, mod, importPath, err.Error()); err != nil {
-				return err
+				return nil, err
 			}
 			continue
 		}
 
-		if err := s.db.PutPackage(tx, platform, mod, docPkg, source); err != nil {
-			return err
+		info := infos[importPath]
+		if info != nil {
+			if s.cfg.CheckExamples {
+				info.Warnings = godoc.CheckExamples(result.Package, docPkg)
+			}
+			warnings, missing := imp.CheckDocLinks(result.Package, docPkg)
+			info.Warnings = append(info.Warnings, warnings...)
+			info.API = godoc.NewAPI(result.Package.Fset, docPkg)
+			for _, path := range missing {
+				if !seen[path] {
+					seen[path] = true
+					linked = append(linked, path)
+				}
+			}
+		}
+		// Pre-render declarations and examples, so that they need not be
+		// rendered for each request
+		pkg := newPackage(mod, platform, importPath, result.Package, docPkg, false)
+		if info != nil {
+			pkg.links = info.Links
+		}
+		fragments := RenderFragments(pkg)
+
+		if err := s.db.PutPackage(tx, platform, mod, docPkg, source, info, fragments); err != nil {
+			return nil, err
+		}
+		if info != nil {
+			if err := s.db.PutImplements(tx, platform, mod, importPath, info.Implements); err != nil {
+				return nil, err
+			}
 		}
 	}
-	return nil
+	return linked, nil
+}
+
+// fetchLinked fetches packages linked from documentation which are not yet
+// in the database in the background, so that the links can be checked when
+// the linking packages are refreshed. Packages linked from the fetched
+// packages are not fetched in turn.
+func (s *Server) fetchLinked(ctx context.Context, platform string, importPaths []string) {
+	if len(importPaths) > maxLinkedFetches {
+		importPaths = importPaths[:maxLinkedFetches]
+	}
+	if len(importPaths) == 0 {
+		return
+	}
+	ctx = withLinked(detach(ctx))
+	go func() {
+		for _, importPath := range importPaths {
+			err := s.fetch(ctx, platform, importPath, internal.LatestVersion)
+			if errors.Is(err, errTooManyFetches) {
+				// The remaining packages are fetched when requested
+				return
+			}
+			if err != nil && !errors.Is(err, ErrFetching) && !errors.Is(err, internal.ErrNotFound) {
+				logger(ctx).Warn("error fetching linked package", "import_path", importPath, "error", err)
+			}
+		}
+	}()
+}
+
+// detectLicenses detects and stores the license files of a module version
+// which was fetched before license files were stored. It does nothing if
+// the module fetch limit is reached, in which case the licenses are
+// detected on a later request.
+func (s *Server) detectLicenses(ctx context.Context, modulePath, version string) {
+	key := modulePath + "@" + version
+	if _, ok := s.detecting.LoadOrStore(key, struct{}{}); ok {
+		return
+	}
+	defer s.detecting.Delete(key)
+	select {
+	case s.moduleFetchSem <- struct{}{}:
+		defer func() { <-s.moduleFetchSem }()
+	default:
+		return
+	}
+
+	log := logger(ctx).With("module", modulePath, "version", version)
+	source, mod, err := s.sources.FindModule(modulePath, version)
+	if err != nil {
+		log.Warn("error detecting licenses", "error", err)
+		return
+	}
+	fsys, err := source.Files(mod)
+	if err != nil {
+		log.Warn("error detecting licenses", "error", err)
+		return
+	}
+	lics, err := licenses.Detect(fsys)
+	if err != nil {
+		log.Warn("error detecting licenses", "error", err)
+		return
+	}
+	if err := s.db.PutDetectedLicenses(ctx, mod, lics); err != nil {
+		log.Error("error storing licenses", "error", err)
+		return
+	}
+	log.Info("detected licenses", "licenses", len(lics))
+	s.cache.Invalidate(modulePath)
 }
 
 // Refresh refreshes the oldest module in the database.
 func (s *Server) Refresh(ctx context.Context) {
+	log := logger(ctx)
 	modulePath, timestamp, err := s.db.Oldest(ctx)
 	if err != nil {
-		log.Printf("Error retrieving oldest module: %v", err)
+		log.Error("error retrieving oldest module", "error", err)
 		return
 	}
 	if modulePath == "" {
@@ -228,9 +580,7 @@ func (s *Server) Refresh(ctx context.Context) {
 		return
 	}
 	s.metrics.bgRefreshTotal.Inc()
-	log.Println("REFRESH", modulePath)
-	if err := s.fetchModule(ctx, s.cfg.Platform, modulePath, internal.LatestVersion); err != nil {
-		log.Printf("Error refreshing %s: %v", modulePath, err)
-		return
-	}
+	log.Info("refreshing module", "module", modulePath, "age", time.Since(timestamp))
+	// Errors are logged by fetchModule
+	s.fetchModule(ctx, s.cfg.Platform, modulePath, internal.LatestVersion)
 }
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"git.sr.ht/~sircmpwn/gddo/internal"
+	"git.sr.ht/~sircmpwn/gddo/internal/webhook"
+)
+
+const (
+	// maxHookSize is the maximum size of a webhook payload.
+	maxHookSize = 1 << 20
+	// maxHookFetches is the maximum number of module versions fetched for
+	// a webhook payload.
+	maxHookFetches = 10
+)
+
+// serveRefreshHook serves the refresh webhook, which forges call when tags
+// are pushed to a repository. The pushed versions of the modules in the
+// repository are fetched in the background. Modules in the database whose
+// path only differs in case from the repository URL are fetched by their
+// path. The "module" query parameter sets the module path of the repository
+// root, for other modules whose path differs from the repository URL.
+func (s *Server) serveRefreshHook(resp http.ResponseWriter, req *http.Request) error {
+	if s.cfg.HookSecret == "" {
+		return internal.ErrNotFound
+	}
+	resp.Header().Set("Cache-Control", "no-store")
+	if req.Method != http.MethodPost {
+		resp.Header().Set("Allow", http.MethodPost)
+		http.Error(resp, "Method not allowed.", http.StatusMethodNotAllowed)
+		return nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(resp, req.Body, maxHookSize))
+	if err != nil {
+		http.Error(resp, "Payload too large.", http.StatusRequestEntityTooLarge)
+		return nil
+	}
+	if !webhook.Verify(req, body, s.cfg.HookSecret) {
+		http.Error(resp, "Invalid signature.", http.StatusUnauthorized)
+		return nil
+	}
+	push, err := webhook.ParsePush(body)
+	if err != nil {
+		http.Error(resp, "Invalid payload: "+err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	if modulePath := req.URL.Query().Get("module"); modulePath != "" {
+		push.ModulePath = modulePath
+	}
+
+	mods := push.Modules()
+	if len(mods) > maxHookFetches {
+		mods = mods[:maxHookFetches]
+	}
+	fetches := make([]string, 0, len(mods))
+	for i := range mods {
+		modulePath, err := s.db.ModulePath(req.Context(), mods[i].Path)
+		if err != nil {
+			return err
+		}
+		mods[i].Path = modulePath
+		if mods[i].Version == "" {
+			mods[i].Version = internal.LatestVersion
+		}
+		fetches = append(fetches, mods[i].Path+"@"+mods[i].Version)
+	}
+	s.metrics.httpHookTotal.Inc()
+	go s.fetchPushed(detach(req.Context()), s.cfg.Platform, mods)
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(resp).Encode(&struct {
+		Fetches []string `json:"fetches"`
+	}{fetches})
+}
+
+// fetchPushed fetches pushed module versions one at a time, so as not to
+// exhaust the fetch limit.
+func (s *Server) fetchPushed(ctx context.Context, platform string, mods []webhook.ModuleVersion) {
+	log := logger(ctx)
+	for _, mv := range mods {
+		log.Info("fetching pushed module", "module", mv.Path, "version", mv.Version)
+		// The version may have been requested before it was pushed
+		if err := s.db.DeleteFetchFailures(ctx, mv.Path); err != nil {
+			log.Error("error deleting failed fetches", "module", mv.Path, "error", err)
+		}
+		err := s.fetch(ctx, platform, mv.Path, mv.Version)
+		if err != nil && !errors.Is(err, ErrFetching) && shouldDisplayError(err) {
+			log.Warn("error fetching pushed module", "module", mv.Path,
+				"version", mv.Version, "error", err)
+		}
+	}
+}
@@ -4,17 +4,24 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	htemp "html/template"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"git.sr.ht/~sircmpwn/gddo/internal"
+	"git.sr.ht/~sircmpwn/gddo/internal/cache"
 	"git.sr.ht/~sircmpwn/gddo/internal/database"
+	"git.sr.ht/~sircmpwn/gddo/internal/godoc"
 	"git.sr.ht/~sircmpwn/gddo/internal/httputil"
+	"git.sr.ht/~sircmpwn/gddo/internal/proxy"
 	"git.sr.ht/~sircmpwn/gddo/static"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -43,6 +50,9 @@ func (s *Server) HTTPHandler() (http.Handler, error) {
 	mux.Handle("/-/about", handler(s.serveAbout))
 	mux.Handle("/-/opensearch.xml", handler(s.serveOpenSearch))
 	mux.Handle("/-/refresh", handler(s.serveRefresh))
+	mux.Handle("/-/feed", handler(s.serveSiteFeed))
+	// Webhook payloads exceed the request size limit of requestCleaner
+	mux.Handle("/-/hooks/refresh", s.errorHandler(s.serveRefreshHook))
 	mux.Handle("/favicon.ico", files.FileHandler("favicon.ico"))
 	mux.Handle("/robots.txt", files.FileHandler("robots.txt"))
 	mux.Handle("/C", http.RedirectHandler("/cmd/cgo", http.StatusMovedPermanently))
@@ -77,8 +87,26 @@ func setFlashMessage(resp http.ResponseWriter, message string) {
 	http.SetCookie(resp, &http.Cookie{Name: "flash", Value: value, Path: "/"})
 }
 
-// httpEtag returns the package entity tag used in HTTP transactions.
-func httpEtag(pkg *Package) string {
+const (
+	// latestMaxAge is how long clients may cache pages of the latest
+	// version of a package.
+	latestMaxAge = 10 * time.Minute
+	// versionMaxAge is how long clients may cache pages of a version of a
+	// package named in the URL. They show the latest version, the version
+	// list, retractions and deprecations, which change when the module is
+	// refreshed.
+	versionMaxAge = time.Hour
+	// sourceMaxAge is how long clients may cache source files of a version
+	// of a package named in the URL, which never change.
+	sourceMaxAge = 365 * 24 * time.Hour
+	// staticMaxAge is how long clients may cache pages which only depend
+	// on the server configuration.
+	staticMaxAge = 24 * time.Hour
+)
+
+// httpEtag returns the entity tag of a view of the package used in HTTP
+// transactions.
+func httpEtag(pkg *Package, view string) string {
 	b := make([]byte, 0, 128)
 	b = append(b, pkg.ImportPath...)
 	b = append(b, 0)
@@ -86,16 +114,77 @@ func httpEtag(pkg *Package) string {
 	b = append(b, 0)
 	b = append(b, pkg.LatestVersion...)
 	b = append(b, 0)
+	b = append(b, pkg.Platform...)
+	b = append(b, 0)
+	b = append(b, view...)
+	b = append(b, 0)
+	b = pkg.Updated.AppendFormat(b, time.RFC3339Nano)
+	b = append(b, 0)
 	b = append(b, pkg.Message...)
+	if pkg.AllDecls {
+		b = append(b, 0, 'm')
+	}
+	// The licenses and README are detected and stored separately from the
+	// module, so they are not covered by its updated time
+	if pkg.LicensesUnknown {
+		b = append(b, 0, 'u')
+	}
+	for _, lic := range pkg.Licenses {
+		b = append(b, 0)
+		b = append(b, lic.FilePath...)
+		for _, typ := range lic.Types {
+			b = append(b, ' ')
+			b = append(b, typ...)
+		}
+	}
+	if pkg.Readme != nil {
+		b = append(b, 0)
+		b = append(b, pkg.Readme.FilePath...)
+		b = append(b, 0)
+		b = append(b, pkg.Readme.Contents...)
+	}
 	return fmt.Sprintf(`"%x"`, sha1.Sum(b))
 }
 
+// notModified sets the validators and the caching policy of a view of the
+// package, and reports whether the copy of the client is current, in which
+// case a 304 response has been written. version is the version named in the
+// URL, or internal.LatestVersion. immutable reports whether the view only
+// depends on that version, and not on the current state of the module.
+func notModified(resp http.ResponseWriter, req *http.Request, pkg *Package, version, view string, immutable bool) bool {
+	h := resp.Header()
+	switch {
+	case pkg.Message != "":
+		// Flash messages are shown once
+		h.Set("Cache-Control", "private, no-store")
+	case pkg.LicenseGated:
+		// The licenses may yet be detected
+		h.Set("Cache-Control", "no-store")
+	case version != internal.LatestVersion && immutable:
+		h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", sourceMaxAge/time.Second))
+	case version != internal.LatestVersion:
+		h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d, must-revalidate", versionMaxAge/time.Second))
+	default:
+		h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", latestMaxAge/time.Second))
+	}
+	etag := httpEtag(pkg, view)
+	h.Set("Etag", etag)
+	if !pkg.Updated.IsZero() {
+		h.Set("Last-Modified", pkg.Updated.UTC().Format(http.TimeFormat))
+	}
+	return httputil.CheckNotModified(resp, req, etag, pkg.Updated)
+}
+
 func (s *Server) servePackage(resp http.ResponseWriter, req *http.Request) error {
 	if req.URL.RawQuery == "status.svg" {
 		s.statusSVG.ServeHTTP(resp, req)
 		return nil
 	}
 
+	if i := strings.Index(req.URL.Path, "/-/src/"); i >= 0 {
+		return s.serveSource(resp, req, req.URL.Path[:i], req.URL.Path[i+len("/-/src/"):])
+	}
+
 	ctx := req.Context()
 	importPath, version, err := s.parseRequestPath(ctx, req.URL.Path)
 	if err != nil {
@@ -107,16 +196,47 @@ func (s *Server) servePackage(resp http.ResponseWriter, req *http.Request) error
 		platform = s.cfg.Platform
 	}
 
-	mode := NeedProject
+	if req.Form.Has("badge") {
+		return s.serveBadge(resp, req, platform, importPath, version, req.Form.Get("badge"))
+	}
+
+	if s.cache != nil && isCacheable(req) {
+		key := cache.Key{
+			Platform:   platform,
+			ImportPath: importPath,
+			Version:    version,
+			View:       pageView(req),
+		}
+		return s.serveCached(resp, req, key, func(w http.ResponseWriter) error {
+			return s.renderPackage(w, req, platform, importPath, version)
+		})
+	}
+	return s.renderPackage(resp, req, platform, importPath, version)
+}
+
+// renderPackage renders a view of the documentation of a package.
+func (s *Server) renderPackage(resp http.ResponseWriter, req *http.Request, platform, importPath, version string) error {
+	ctx := req.Context()
+	// Licenses are needed to tell whether the package is gated
+	mode := NeedProject | NeedLicenses
 	switch req.Form.Get("view") {
 	case "versions":
 	case "platforms":
 	case "imports":
 		mode |= NeedImports
 	case "tools":
+	case "feed":
 	case "import-graph":
+	case "license":
+	case "test-api":
+		mode |= NeedTestAPI
+	case "warnings":
+	case "report":
 	default:
-		mode |= NeedDirectories
+		mode |= NeedDirectories | NeedReadme | NeedImplements | NeedFragments
+		if req.Form.Get("m") == "all" {
+			mode |= NeedUnexported
+		}
 	}
 
 	pkg, err := s.loadPackage(ctx, platform, importPath, version, mode)
@@ -130,6 +250,48 @@ func (s *Server) servePackage(resp http.ResponseWriter, req *http.Request) error
 	}
 
 	pkg.Message = getFlashMessage(resp, req)
+	pkg.LicenseGated = s.licenseGated(pkg)
+	if pkg.LicenseGated && !ungatedViews[req.Form.Get("view")] {
+		// Views showing documentation, source code or examples, and
+		// examples run or shared, are replaced by the documentation page
+		// explaining why it is hidden
+		resp.Header().Set("Cache-Control", "no-store")
+		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+		resp.WriteHeader(http.StatusUnavailableForLegalReasons)
+		return NewRenderer(pkg, s.cfg).ExecuteHTML(s.templates.HTML("doc.html"), resp, pkg)
+	}
+
+	view := pageView(req)
+	if view == "" || view == "m=all" {
+		if run := req.Form.Get("run"); run != "" {
+			return s.serveRun(resp, req, pkg, run)
+		}
+		if play := req.Form.Get("play"); play != "" {
+			u, err := s.playURL(ctx, pkg, play)
+			if err != nil {
+				return err
+			}
+			http.Redirect(resp, req, u, http.StatusMovedPermanently)
+			return nil
+		}
+		s.metrics.httpPackageTotal.Inc()
+	}
+
+	var uri string
+	if req.Form.Get("view") == "tools" {
+		// The tools view shows the URL of the package on this server
+		uri = fmt.Sprintf("%s/%s", getRootURL(req), importPath)
+		resp.Header().Set("Vary", "X-Forwarded-Proto")
+		view = "tools " + uri
+	}
+	if req.Form.Get("view") == "feed" {
+		// Feeds link to the package on this server
+		resp.Header().Set("Vary", "X-Forwarded-Proto")
+		view = "feed " + getRootURL(req)
+	}
+	if notModified(resp, req, pkg, version, view, false) {
+		return nil
+	}
 
 	renderer := NewRenderer(pkg, s.cfg)
 
@@ -143,39 +305,135 @@ func (s *Server) servePackage(resp http.ResponseWriter, req *http.Request) error
 	case "imports":
 		return renderer.ExecuteHTML(s.templates.HTML("imports.html"), resp, pkg)
 
+	case "license":
+		return renderer.ExecuteHTML(s.templates.HTML("license.html"), resp, pkg)
+
 	case "tools":
-		uri := fmt.Sprintf("%s/%s", getRootURL(req), importPath)
 		return renderer.ExecuteHTML(s.templates.HTML("tools.html"), resp, &struct {
 			*Package
 			URI string
 		}{pkg, uri})
 
-	default:
-		if play := req.Form.Get("play"); play != "" {
-			u, err := s.playURL(ctx, pkg, req.Form.Get("play"))
-			if err != nil {
-				return err
-			}
-			http.Redirect(resp, req, u, http.StatusMovedPermanently)
-			return nil
-		}
+	case "feed":
+		return s.serveFeed(resp, req, pkg)
 
-		s.metrics.httpPackageTotal.Inc()
+	case "test-api":
+		return renderer.ExecuteHTML(s.templates.HTML("testapi.html"), resp, pkg)
 
-		etag := httpEtag(pkg)
-		if req.Header.Get("If-None-Match") == etag {
-			resp.WriteHeader(http.StatusNotModified)
-		}
+	case "warnings":
+		return serveWarnings(resp, pkg)
+
+	case "report":
+		return renderer.ExecuteHTML(s.templates.HTML("report.html"), resp, &struct {
+			*Package
+			Report *Report
+		}{pkg, NewReport(pkg)})
 
-		resp.Header().Set("Etag", etag)
+	default:
 		return renderer.ExecuteHTML(s.templates.HTML("doc.html"), resp, pkg)
 	}
 }
 
+// serveWarnings responds with the warnings of the package as JSON.
+func serveWarnings(resp http.ResponseWriter, pkg *Package) error {
+	warnings := pkg.Warnings
+	if warnings == nil {
+		warnings = []godoc.Warning{}
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(resp).Encode(&struct {
+		ImportPath string          `json:"import_path"`
+		Version    string          `json:"version"`
+		Platform   string          `json:"platform"`
+		Warnings   []godoc.Warning `json:"warnings"`
+	}{pkg.ImportPath, pkg.Version, pkg.Platform, warnings})
+}
+
+// licenseGated reports whether the documentation of the package is hidden
+// because no known license applies to it. Packages whose licenses have not
+// been detected yet are hidden until they are.
+func (s *Server) licenseGated(pkg *Package) bool {
+	return s.cfg.RequireLicense && pkg.ModulePath != proxy.StdlibModulePath &&
+		(pkg.LicensesUnknown || !pkg.HasKnownLicense())
+}
+
+// ungatedViews lists the views which are shown for packages whose
+// documentation is hidden because no known license applies to them.
+var ungatedViews = map[string]bool{
+	"versions":  true,
+	"platforms": true,
+	"imports":   true,
+	"license":   true,
+	"tools":     true,
+}
+
+// serveSource serves a source file of the package at pkgPath.
+func (s *Server) serveSource(resp http.ResponseWriter, req *http.Request, pkgPath, file string) error {
+	ctx := req.Context()
+	importPath, version, err := s.parseRequestPath(ctx, pkgPath)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(file, "/") || !strings.HasSuffix(file, ".go") {
+		return internal.ErrNotFound
+	}
+
+	platform := req.Form.Get("platform")
+	if platform == "" {
+		platform = s.cfg.Platform
+	}
+
+	pkg, err := s.loadPackage(ctx, platform, importPath, version, NeedProject|NeedLicenses)
+	var mismatch ErrMismatch
+	if errors.As(err, &mismatch) {
+		http.Redirect(resp, req, "/"+mismatch.ActualPath, http.StatusFound)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pkg.LicenseGated = s.licenseGated(pkg)
+
+	dir := pkg.innerPath
+	if dir == "" {
+		dir = "."
+	}
+	files, err := s.db.SourceFiles(ctx, pkg.ModulePath, pkg.Version, dir)
+	if err != nil {
+		return err
+	}
+	if _, ok := files[file]; !ok {
+		return internal.ErrNotFound
+	}
+
+	if notModified(resp, req, pkg, version, "src "+file, true) {
+		return nil
+	}
+
+	renderer := NewRenderer(pkg, s.cfg)
+	var source htemp.HTML
+	if !pkg.LicenseGated {
+		source = renderer.SourceHTML(file, files)
+	}
+	return renderer.ExecuteHTML(s.templates.HTML("source.html"), resp, &struct {
+		*Package
+		File   string
+		Source htemp.HTML
+	}{pkg, file, source})
+}
+
 func (s *Server) serveRefresh(resp http.ResponseWriter, req *http.Request) error {
 	s.metrics.httpRefreshTotal.Inc()
+	resp.Header().Set("Cache-Control", "no-store")
+	if client := clientFromContext(req.Context()); !s.refreshLimiter.Allow(client) {
+		return ErrRateLimited{RetryAfter: s.refreshLimiter.RetryAfter(client)}
+	}
 	importPath := req.Form.Get("import_path")
 	platform := req.Form.Get("platform")
+	// Retry fetches which failed recently
+	if err := s.db.DeleteFetchFailures(req.Context(), importPath); err != nil {
+		return err
+	}
 	err := s.fetch(req.Context(), platform, importPath, internal.LatestVersion)
 	var mismatch ErrMismatch
 	if errors.As(err, &mismatch) {
@@ -218,6 +476,10 @@ func (s *Server) serveHome(resp http.ResponseWriter, req *http.Request) error {
 			http.Redirect(resp, req, "/"+mismatch.ActualPath, http.StatusFound)
 			return nil
 		}
+		var limited ErrRateLimited
+		if errors.As(err, &limited) {
+			return err
+		}
 		msg, _ = errorMessage(err)
 	}
 
@@ -235,6 +497,8 @@ func (s *Server) serveHome(resp http.ResponseWriter, req *http.Request) error {
 
 func (s *Server) serveAbout(resp http.ResponseWriter, req *http.Request) error {
 	uri := fmt.Sprintf("%s/%s", getRootURL(req), "archive/tar")
+	resp.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", staticMaxAge/time.Second))
+	resp.Header().Set("Vary", "X-Forwarded-Proto")
 	return s.templates.ExecuteHTML(resp, "about.html", &struct {
 		URI string
 	}{uri})
@@ -253,6 +517,8 @@ func getRootURL(req *http.Request) string {
 
 func (s *Server) serveOpenSearch(resp http.ResponseWriter, req *http.Request) error {
 	resp.Header().Set("Content-Type", "application/opensearchdescription+xml")
+	resp.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", staticMaxAge/time.Second))
+	resp.Header().Set("Vary", "X-Forwarded-Proto")
 	root := getRootURL(req)
 	return s.templates.Execute(resp, "opensearch.xml", root)
 }
@@ -271,34 +537,58 @@ func (rc requestCleaner) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 func (s *Server) errorHandler(fn func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
 	return func(resp http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		id := requestID(req)
+		resp.Header().Set("X-Request-ID", id)
+		log := slog.Default().With("request_id", id)
 		defer func() {
 			if rv := recover(); rv != nil {
-				logPanic(req.URL, rv)
+				logPanic(log, req.URL, rv)
 				resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
 				resp.WriteHeader(http.StatusInternalServerError)
 				io.WriteString(resp, "Internal server error.")
 			}
 		}()
 
+		ctx := withClient(req.Context(), s.clientKey(req))
+		req = req.WithContext(withLogger(ctx, log))
 		rb := new(httputil.ResponseBuffer)
 		err := fn(rb, req)
 		if err == nil {
 			rb.WriteTo(resp)
+			log.Debug("served request", "method", req.Method, "url", req.URL.String(),
+				"status", rb.Status(), "duration", time.Since(start))
 			return
 		}
 		if errors.Is(err, context.Canceled) {
 			// Request was cancelled
+			log.Debug("request cancelled", "method", req.Method, "url", req.URL.String(),
+				"duration", time.Since(start))
 			return
 		}
 
 		msg, status := errorMessage(err)
+		if status >= http.StatusInternalServerError || errors.Is(err, ErrFetching) {
+			// The page may be available on the next request
+			resp.Header().Set("Cache-Control", "no-store")
+		}
+		var limited ErrRateLimited
+		if errors.As(err, &limited) {
+			s.metrics.httpRateLimited.Inc()
+			resp.Header().Set("Cache-Control", "no-store")
+			resp.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+		}
 		resp.WriteHeader(status)
 		s.templates.ExecuteHTML(resp, "notfound.html", &struct {
 			Status  int
 			Message string
 		}{status, msg})
 		if status == http.StatusInternalServerError {
-			log.Printf("Error serving %s: %v", req.URL, err)
+			log.Error("error serving request", "method", req.Method, "url", req.URL.String(),
+				"error", err, "duration", time.Since(start))
+		} else {
+			log.Debug("served request", "method", req.Method, "url", req.URL.String(),
+				"status", status, "error", err, "duration", time.Since(start))
 		}
 	}
 }
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/database"
+)
+
+const (
+	// implementersTTL is the time for which the known implementers of the
+	// interfaces of a package are cached.
+	implementersTTL = 10 * time.Minute
+	// maxCachedImplementers is the maximum number of packages whose
+	// implementers are cached.
+	maxCachedImplementers = 10000
+)
+
+type implementersKey struct {
+	platform, importPath string
+}
+
+// implementers returns the known implementers of the interfaces of the
+// package, keyed by interface name. They are looked up with an expensive
+// query, so they are cached.
+func (s *Server) implementers(ctx context.Context, platform, importPath string) (map[string]*database.Implementers, error) {
+	key := implementersKey{platform, importPath}
+	if impls, ok := s.implementersCache.Get(key); ok {
+		return impls, nil
+	}
+	impls, err := s.db.Implementers(ctx, platform, importPath)
+	if err != nil {
+		return nil, err
+	}
+	s.implementersCache.Put(key, impls)
+	return impls, nil
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/httputil"
+)
+
+type clientContextKey struct{}
+
+// withClient returns a context carrying the rate limiting key of the client
+// which made a request.
+func withClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, client)
+}
+
+// clientFromContext returns the rate limiting key of the client carried by
+// ctx, or the empty string for contexts of background work.
+func clientFromContext(ctx context.Context) string {
+	client, _ := ctx.Value(clientContextKey{}).(string)
+	return client
+}
+
+// clientKey returns the key identifying the client of the request for rate
+// limiting. IPv6 clients are identified by their /64 prefix, since a single
+// client commonly controls all addresses in it.
+func (s *Server) clientKey(req *http.Request) string {
+	addr := httputil.ClientIP(req, s.trusted)
+	switch {
+	case !addr.IsValid():
+		return req.RemoteAddr
+	case addr.Is6():
+		return netip.PrefixFrom(addr, 64).Masked().String()
+	}
+	return addr.String()
+}
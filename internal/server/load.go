@@ -10,7 +10,7 @@ import (
 	"go/build"
 	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"os"
 	"path"
 	"strings"
@@ -28,6 +28,12 @@ const (
 	NeedDirectories LoadMode = 1 << iota
 	NeedImports
 	NeedProject
+	NeedLicenses
+	NeedReadme
+	NeedImplements
+	NeedUnexported
+	NeedFragments
+	NeedTestAPI
 )
 
 func (s *Server) loadPackage(ctx context.Context, platform, importPath, version string, mode LoadMode) (*Package, error) {
@@ -36,7 +42,11 @@ func (s *Server) loadPackage(ctx context.Context, platform, importPath, version
 		return nil, err
 	}
 	if dpkg == nil {
-		// Try fetching the package
+		// Try fetching the package, unless the client which requested it
+		// has exceeded its fetch limit
+		if client := clientFromContext(ctx); client != "" && !s.fetchLimiter.Allow(client) {
+			return nil, ErrRateLimited{RetryAfter: s.fetchLimiter.RetryAfter(client)}
+		}
 		err := s.fetch(ctx, platform, importPath, version)
 		if err != nil {
 			return nil, err
@@ -45,19 +55,49 @@ func (s *Server) loadPackage(ctx context.Context, platform, importPath, version
 		if err != nil {
 			return nil, err
 		}
-	}
-	if dpkg == nil {
-		return nil, internal.ErrNotFound
+		if dpkg == nil {
+			// The module was found, but doesn't contain the package.
+			// Remember it, so that the module isn't fetched again on
+			// every request.
+			s.rememberFailure(ctx, platform, importPath, version, internal.ErrNotFound)
+			return nil, internal.ErrNotFound
+		}
 	}
 
 	src, err := godoc.DecodePackage(dpkg.Source)
 	if err != nil {
 		return nil, err
 	}
-	pkg, err := NewPackage(&dpkg.Module, platform, importPath, src)
+	pkg, err := NewPackage(&dpkg.Module, platform, importPath, src, mode&NeedUnexported != 0)
 	if err != nil {
 		return nil, err
 	}
+	pkg.links = dpkg.Links
+	pkg.promoted = dpkg.Promoted
+	pkg.Warnings = dpkg.Warnings
+
+	if mode&NeedTestAPI != 0 {
+		pkg.TestAPI = godoc.BuildTestDoc(src, importPath)
+		pkg.ExampleFiles = godoc.ExampleFiles(src)
+	}
+
+	// The stored fragments save rendering the declarations and comments,
+	// but the package is still decoded and its documentation built, as the
+	// pages need its index, examples and notes
+	if mode&NeedFragments != 0 && !pkg.AllDecls {
+		if dpkg.Fragments.Current() {
+			pkg.fragments = dpkg.Fragments
+		} else {
+			// Rebuild fragments which are missing or were rendered by
+			// another format version
+			pkg.fragments = RenderFragments(pkg)
+			err := s.db.PutFragments(ctx, platform, importPath, dpkg.Version, pkg.fragments)
+			if err != nil {
+				logger(ctx).Error("error storing rendered documentation",
+					"import_path", importPath, "version", dpkg.Version, "error", err)
+			}
+		}
+	}
 
 	if mode&NeedDirectories != 0 {
 		dirs, err := s.db.Directories(ctx, platform, dpkg.ModulePath, dpkg.Version, importPath)
@@ -83,6 +123,62 @@ func (s *Server) loadPackage(ctx context.Context, platform, importPath, version
 		pkg.project = project
 	}
 
+	if mode&NeedLicenses != 0 && !dpkg.LicensesDetected &&
+		dpkg.ModulePath != proxy.StdlibModulePath {
+		// The licenses are unknown until they are detected
+		pkg.LicensesUnknown = true
+		go s.detectLicenses(detach(ctx), dpkg.ModulePath, dpkg.Version)
+	} else if mode&NeedLicenses != 0 {
+		lics, err := s.db.Licenses(ctx, dpkg.ModulePath, dpkg.Version)
+		if err != nil {
+			return nil, err
+		}
+		dir := pkg.innerPath
+		if dir == "" {
+			dir = "."
+		}
+		for _, lic := range lics {
+			if lic.AppliesTo(dir) {
+				pkg.Licenses = append(pkg.Licenses, lic)
+			}
+		}
+	}
+
+	if mode&NeedReadme != 0 && importPath == dpkg.ModulePath {
+		pkg.Readme, err = s.db.Readme(ctx, dpkg.ModulePath, dpkg.Version)
+		if err != nil {
+			return nil, err
+		}
+		if pkg.Readme != nil && pkg.Readme.Rendered == "" {
+			// Render README files which were stored before they were
+			// rendered at fetch time
+			project := pkg.project
+			if project == nil {
+				project, err = s.db.Project(ctx, dpkg.ModulePath)
+				if err != nil {
+					return nil, err
+				}
+			}
+			pkg.Readme.Rendered = pkg.Readme.HTML(readmeResolver(project, dpkg.Reference))
+			err = s.db.PutReadmeHTML(ctx, dpkg.ModulePath, dpkg.Version, pkg.Readme.Rendered)
+			if err != nil {
+				logger(ctx).Error("error storing rendered README",
+					"module", dpkg.ModulePath, "version", dpkg.Version, "error", err)
+			}
+		}
+	}
+
+	if mode&NeedImplements != 0 {
+		pkg.Implements, err = s.db.Implements(ctx, platform, importPath, dpkg.Version)
+		if err != nil {
+			return nil, err
+		}
+		pkg.Implementers, err = s.implementers(ctx, platform, importPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return pkg, nil
 }
 
@@ -94,7 +190,7 @@ type loadResult struct {
 }
 
 // loadPackages loads Go packages from the given filesystem.
-func loadPackages(platform, modulePath string, fsys fs.FS) (map[string]loadResult, error) {
+func loadPackages(log *slog.Logger, platform, modulePath string, fsys fs.FS) (map[string]loadResult, error) {
 	if !validPlatform(platform) {
 		return nil, ErrInvalidPlatform
 	}
@@ -156,7 +252,7 @@ func loadPackages(platform, modulePath string, fsys fs.FS) (map[string]loadResul
 		// built and run from that directory.
 		// We're not set up to handle invalid import paths, so skip these packages.
 		if err := module.CheckFilePath(pathname); err != nil {
-			log.Printf("module %s: %v", modulePath, err)
+			log.Warn("skipping invalid file path", "path", pathname, "error", err)
 			incompleteDirs[innerPath] = err
 			return nil
 		}
@@ -165,8 +261,7 @@ func loadPackages(platform, modulePath string, fsys fs.FS) (map[string]loadResul
 			return err
 		}
 		if info.Size() > MaxFileSize {
-			log.Printf("module %s: file %s size %d exceeds max limit %d",
-				modulePath, pathname, info.Size(), MaxFileSize)
+			log.Warn("skipping large file", "path", pathname, "size", info.Size())
 			err := fmt.Errorf("Unable to process %s: file size %d exceeds max limit %d",
 				pathname, info.Size(), MaxFileSize)
 			incompleteDirs[innerPath] = err
@@ -251,6 +346,44 @@ func loadPackages(platform, modulePath string, fsys fs.FS) (map[string]loadResul
 	return results, nil
 }
 
+// loadSourceFiles returns the contents of the Go source files in the given
+// filesystem, keyed by path. Files in directories ignored by the go tool,
+// and files larger than MaxSourceFileSize, are skipped.
+func loadSourceFiles(fsys fs.FS) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := fs.WalkDir(fsys, ".", func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if ignoredByGoTool(d.Name()) || d.Name() == "vendor" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !strings.HasSuffix(pathname, ".go") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > MaxSourceFileSize {
+			return nil
+		}
+		contents, err := fs.ReadFile(fsys, pathname)
+		if err != nil {
+			return err
+		}
+		files[pathname] = contents
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
 // ignoredByGoTool reports whether the given file or directory would be
 // ignored by the go tool.
 //
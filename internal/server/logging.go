@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/httputil"
+)
+
+// NewLogger returns a logger writing to w with the level and format
+// configured by cfg.
+func NewLogger(w io.Writer, cfg *Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", cfg.LogLevel)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch cfg.LogFormat {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q", cfg.LogFormat)
+}
+
+type loggerContextKey struct{}
+
+// withLogger returns a context carrying the logger.
+func withLogger(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, log)
+}
+
+// logger returns the logger carried by ctx, which records the request or
+// fetch the context belongs to, or the default logger.
+func logger(ctx context.Context) *slog.Logger {
+	if log, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return log
+	}
+	return slog.Default()
+}
+
+// detach returns a background context carrying the logger of ctx and
+// whether it belongs to a fetch of a linked package, for work which
+// outlives the request or fetch of ctx.
+func detach(ctx context.Context) context.Context {
+	bg := withLogger(context.Background(), logger(ctx))
+	if isLinked(ctx) {
+		bg = withLinked(bg)
+	}
+	return bg
+}
+
+// newID returns a random ID correlating log records.
+func newID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// requestID returns the ID of the request, which is taken from the
+// X-Request-ID header if a reverse proxy has set it.
+func requestID(req *http.Request) string {
+	if id := httputil.RequestID(req); id != "" {
+		return id
+	}
+	return newID()
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"go/doc"
 	"go/token"
+	"html/template"
 	"path"
 	"sort"
 	"strings"
@@ -11,7 +12,10 @@ import (
 	"git.sr.ht/~sircmpwn/gddo/internal/autodiscovery"
 	"git.sr.ht/~sircmpwn/gddo/internal/database"
 	"git.sr.ht/~sircmpwn/gddo/internal/godoc"
+	"git.sr.ht/~sircmpwn/gddo/internal/licenses"
 	"git.sr.ht/~sircmpwn/gddo/internal/proxy"
+	"git.sr.ht/~sircmpwn/gddo/internal/readme"
+	"git.sr.ht/~sircmpwn/gddo/internal/render"
 )
 
 // Package is a [doc.Package] with additional information for use in templates.
@@ -24,42 +28,130 @@ type Package struct {
 	Platform    string
 	Directories []database.Synopsis
 	Imported    []database.Synopsis
+	Licenses    []*licenses.License
+	Readme      *readme.Readme
 	Message     string
 
+	// AllDecls reports whether unexported declarations are documented.
+	AllDecls bool
+
+	// TestAPI documents the exported identifiers declared in test files.
+	// It is only built for the test API view.
+	TestAPI []*doc.Package
+	// ExampleFiles holds the test files which declare examples.
+	ExampleFiles []*godoc.File
+
+	// HasTestFiles reports whether the package has test files.
+	HasTestFiles bool
+
+	// Implements holds the interfaces implemented by the package's types
+	// and Implementers the known types implementing its interfaces, both
+	// keyed by type name.
+	Implements   map[string][]godoc.Implementation
+	Implementers map[string]*database.Implementers
+
+	// LicensesUnknown reports whether the license files of the package
+	// have not been detected yet.
+	LicensesUnknown bool
+
+	// LicenseGated reports whether documentation is hidden because no
+	// known license applies to the package.
+	LicenseGated bool
+
+	// Warnings lists problems found in the documentation of the package
+	// when it was fetched.
+	Warnings []godoc.Warning
+
 	project     *autodiscovery.Project
+	links       godoc.Links
+	promoted    godoc.Promoted
+	fragments   *render.Fragments
 	innerPath   string
 	examples    []*Example
 	examplesMap map[any][]*Example
 }
 
-// NewPackage returns a new package for use in templates.
+// NewPackage returns a new package for use in templates. If allDecls is
+// true, unexported declarations are documented.
 // If src is nil, no package documentation will be displayed.
-func NewPackage(mod *internal.Module, platform, importPath string, src *godoc.Package) (*Package, error) {
-	// Compute inner path
-	innerPath := strings.TrimPrefix(importPath, mod.ModulePath)
-	innerPath = strings.TrimPrefix(innerPath, "/")
-
+func NewPackage(mod *internal.Module, platform, importPath string, src *godoc.Package, allDecls bool) (*Package, error) {
 	// Build documentation
-	docPkg, err := godoc.BuildDoc(src, importPath)
+	docPkg, err := godoc.BuildDoc(src, importPath, allDecls)
 	if err != nil {
 		return nil, err
 	}
 
+	return newPackage(mod, platform, importPath, src, docPkg, allDecls), nil
+}
+
+// newPackage returns a package for use in templates with the documentation
+// docPkg built from src.
+func newPackage(mod *internal.Module, platform, importPath string, src *godoc.Package, docPkg *doc.Package, allDecls bool) *Package {
+	// Compute inner path
+	innerPath := strings.TrimPrefix(importPath, mod.ModulePath)
+	innerPath = strings.TrimPrefix(innerPath, "/")
+
 	var fset *token.FileSet
+	hasTestFiles := false
 	if src != nil {
 		fset = src.Fset
+		for _, f := range src.Files {
+			if strings.HasSuffix(f.Name, "_test.go") {
+				hasTestFiles = true
+				break
+			}
+		}
 	}
 
 	pkg := &Package{
-		Module:    mod,
-		Package:   docPkg,
-		FileSet:   fset,
-		Synopsis:  docPkg.Synopsis(docPkg.Doc),
-		Platform:  platform,
-		innerPath: innerPath,
+		Module:       mod,
+		Package:      docPkg,
+		FileSet:      fset,
+		Synopsis:     docPkg.Synopsis(docPkg.Doc),
+		Platform:     platform,
+		AllDecls:     allDecls,
+		HasTestFiles: hasTestFiles,
+		innerPath:    innerPath,
 	}
 	pkg.collectExamples()
-	return pkg, nil
+	return pkg
+}
+
+// BrokenLinks returns the set of the texts of the doc links in the package
+// documentation which were found to be broken when it was fetched.
+func (p *Package) BrokenLinks() map[string]bool {
+	broken := make(map[string]bool)
+	for _, w := range p.Warnings {
+		if w.Link != "" {
+			broken[w.Link] = true
+		}
+	}
+	return broken
+}
+
+// filePos returns the position of the given line of a source file of the
+// package, or [token.NoPos] if it is unknown.
+func (p *Package) filePos(file string, line int) token.Pos {
+	pos := token.NoPos
+	if p.FileSet == nil || line <= 0 {
+		return pos
+	}
+	p.FileSet.Iterate(func(f *token.File) bool {
+		if f.Name() == file {
+			if line <= f.LineCount() {
+				pos = f.LineStart(line)
+			}
+			return false
+		}
+		return true
+	})
+	return pos
+}
+
+// PromotedMembers returns the members promoted to the named type from
+// embedded types which are not listed among its methods.
+func (p *Package) PromotedMembers(typeName string) []godoc.Member {
+	return p.promoted[typeName]
 }
 
 // Title returns a title for the package.
@@ -115,6 +207,58 @@ func (p *Package) FileURL(file string) string {
 	return ""
 }
 
+// ReadmeHTML returns the rendered README file of the module.
+func (p *Package) ReadmeHTML() template.HTML {
+	if p.Readme == nil {
+		return ""
+	}
+	return p.Readme.Rendered
+}
+
+// readmeResolver returns a resolver which resolves the relative links and
+// images of a README file against the project source at the reference.
+func readmeResolver(project *autodiscovery.Project, ref string) readme.Resolver {
+	return func(file string, image bool) string {
+		if project == nil {
+			return ""
+		}
+		if image {
+			return project.RawFileURL(ref, "", file)
+		}
+		return project.FileURL(ref, "", file)
+	}
+}
+
+// LicenseTypes returns the SPDX identifiers of the licenses which apply to
+// the package. Unrecognized license files are reported as "Unknown".
+func (p *Package) LicenseTypes() []string {
+	var types []string
+	seen := make(map[string]bool)
+	for _, lic := range p.Licenses {
+		ts := lic.Types
+		if !lic.Known() {
+			ts = []string{"Unknown"}
+		}
+		for _, t := range ts {
+			if !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// HasKnownLicense reports whether a recognized license applies to the package.
+func (p *Package) HasKnownLicense() bool {
+	for _, lic := range p.Licenses {
+		if lic.Known() {
+			return true
+		}
+	}
+	return false
+}
+
 // Example is a [doc.Example] with additional information for use in templates.
 type Example struct {
 	*doc.Example
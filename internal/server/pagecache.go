@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/cache"
+	"git.sr.ht/~sircmpwn/gddo/internal/httputil"
+)
+
+// isCacheable reports whether the response to a package request may be
+// served from and stored in the page cache.
+func isCacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if req.Form.Get("run") != "" || req.Form.Get("play") != "" {
+		return false
+	}
+	if v := req.Form.Get("view"); v == "tools" || v == "feed" {
+		// The tools view and feeds depend on the request host
+		return false
+	}
+	// Flash messages are shown once
+	_, err := req.Cookie("flash")
+	return err == http.ErrNoCookie
+}
+
+// pageView returns the view of a package request used in cache keys.
+// Unknown views render the documentation and share its key.
+func pageView(req *http.Request) string {
+	switch view := req.Form.Get("view"); view {
+	case "versions", "platforms", "imports", "import-graph", "license", "test-api", "warnings", "report":
+		return view
+	}
+	if req.Form.Get("m") == "all" {
+		return "m=all"
+	}
+	return ""
+}
+
+// serveCached serves the page for the key from the page cache. If the page
+// is not cached, it is rendered with render and cached if successful.
+func (s *Server) serveCached(resp http.ResponseWriter, req *http.Request, key cache.Key, render func(http.ResponseWriter) error) error {
+	if page := s.cache.Get(key); page != nil {
+		s.metrics.httpCacheHits.Inc()
+		if key.View == "" || key.View == "m=all" {
+			s.metrics.httpPackageTotal.Inc()
+		}
+		for k, v := range page.Header.Clone() {
+			resp.Header()[k] = v
+		}
+		modtime, _ := http.ParseTime(page.Header.Get("Last-Modified"))
+		if httputil.CheckNotModified(resp, req, page.Header.Get("Etag"), modtime) {
+			return nil
+		}
+		_, err := resp.Write(page.Body)
+		return err
+	}
+
+	// Obtain the generation before loading the package, so that pages
+	// rendered from data replaced in the meantime are not cached
+	gen := s.cache.Generation()
+	rec := &pageRecorder{ResponseWriter: resp}
+	if err := render(rec); err != nil {
+		return err
+	}
+	if rec.status == 0 || rec.status == http.StatusOK {
+		s.cache.Put(key, &cache.Page{
+			Header:  resp.Header().Clone(),
+			Body:    rec.body.Bytes(),
+			Created: time.Now(),
+		}, gen)
+	}
+	return nil
+}
+
+// pageRecorder is an http.ResponseWriter which records the status and body
+// of a response while writing it.
+type pageRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *pageRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *pageRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
@@ -9,14 +9,15 @@ package server
 import (
 	"bytes"
 	"context"
-	"errors"
-	"fmt"
+	"encoding/json"
 	"go/doc"
 	"go/format"
-	"io"
 	"net/http"
+	"runtime"
 	"strings"
 
+	"git.sr.ht/~sircmpwn/gddo/internal"
+	"git.sr.ht/~sircmpwn/gddo/internal/sandbox"
 	"git.sr.ht/~sircmpwn/gddo/internal/stdlib"
 )
 
@@ -60,46 +61,119 @@ func findExample(pkg *Package, symbol, suffix string) *doc.Example {
 	return nil
 }
 
-func (s *Server) playURL(ctx context.Context, pkg *Package, id string) (string, error) {
+// exampleProgram returns the source code of the program for the given
+// example ID, and the go.mod file it requires, if any.
+func exampleProgram(pkg *Package, id string) (*doc.Example, []byte, []byte, error) {
 	symbol, suffix, _ := strings.Cut(id, "-")
 	ex := findExample(pkg, symbol, suffix)
 	if ex == nil || ex.Play == nil {
-		return "", errors.New("example not found")
+		return nil, nil, nil, internal.ErrNotFound
 	}
 
 	var buf bytes.Buffer
 	if err := format.Node(&buf, pkg.FileSet, ex.Play); err != nil {
-		return "", err
+		return nil, nil, nil, err
 	}
+	var gomod []byte
 	if !stdlib.Contains(pkg.ModulePath) {
-		buf.WriteString(`
--- go.mod --
-module play.ground
-
-require `)
-		buf.WriteString(pkg.ModulePath)
-		buf.WriteByte(' ')
-		buf.WriteString(pkg.Version)
-		buf.WriteByte('\n')
+		gomod = []byte("module play.ground\n\nrequire " +
+			pkg.ModulePath + " " + pkg.Version + "\n")
 	}
+	return ex, buf.Bytes(), gomod, nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://play.golang.org/share", &buf)
+// playURL shares the example with the given ID with the playground and
+// returns the URL at which it can be viewed.
+func (s *Server) playURL(ctx context.Context, pkg *Package, id string) (string, error) {
+	if s.playground == nil {
+		return "", internal.ErrNotFound
+	}
+	_, prog, gomod, err := exampleProgram(pkg, id)
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Content-Type", "text/plain")
-	req.Header.Set("User-Agent", s.cfg.UserAgent)
-	resp, err := s.httpClient.Do(req)
+
+	buf := bytes.NewBuffer(prog)
+	if gomod != nil {
+		buf.WriteString("\n-- go.mod --\n")
+		buf.Write(gomod)
+	}
+	return s.playground.Share(ctx, buf.Bytes())
+}
+
+// runResponse is the response to a request to run an example.
+type runResponse struct {
+	*sandbox.Result
+	// Expected output of the example, and whether it matched the output.
+	// Passed is nil if the example has no output comment.
+	Want   string `json:"want,omitempty"`
+	Passed *bool  `json:"passed,omitempty"`
+}
+
+// serveRun runs the example with the given ID in the sandbox and responds
+// with its output.
+func (s *Server) serveRun(resp http.ResponseWriter, req *http.Request, pkg *Package, id string) error {
+	if s.sandbox == nil {
+		return internal.ErrNotFound
+	}
+	if req.Method != http.MethodPost {
+		resp.Header().Set("Allow", http.MethodPost)
+		http.Error(resp, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	ex, prog, gomod, err := exampleProgram(pkg, id)
 	if err != nil {
-		return "", err
+		return err
+	}
+	// Running an example costs about as much as fetching a module, so runs
+	// count against the fetch rate limit of the client, while runSem only
+	// limits how many examples run at the same time
+	if client := clientFromContext(req.Context()); client != "" && !s.fetchLimiter.Allow(client) {
+		return ErrRateLimited{RetryAfter: s.fetchLimiter.RetryAfter(client)}
+	}
+	select {
+	case s.runSem <- struct{}{}:
+		defer func() { <-s.runSem }()
+	default:
+		return ErrBusy
+	}
+	if gomod == nil {
+		gomod = []byte("module play.ground\n")
 	}
-	defer resp.Body.Close()
-	p, err := io.ReadAll(resp.Body)
+	// Use the language version of the server's toolchain rather than
+	// the default for go.mod files without a go directive
+	if v := goVersion(); v != "" {
+		gomod = append(gomod, "\ngo "+v+"\n"...)
+	}
+
+	result, err := s.sandbox.Run(req.Context(), map[string][]byte{
+		"main.go": prog,
+		"go.mod":  gomod,
+	})
 	if err != nil {
-		return "", err
+		return err
 	}
-	if resp.StatusCode > 399 {
-		return "", fmt.Errorf("Error from play.golang.org: %s", p)
+	r := runResponse{Result: result}
+	if ex.Output != "" || ex.EmptyOutput {
+		passed := !result.TimedOut && result.ExitCode == 0 &&
+			sandbox.OutputMatches(result.Output, ex.Output, ex.Unordered)
+		r.Want = ex.Output
+		r.Passed = &passed
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(resp).Encode(&r)
+}
+
+// goVersion returns the language version of the Go toolchain, such as
+// "1.21", or the empty string for development versions.
+func goVersion() string {
+	v := strings.TrimPrefix(runtime.Version(), "go")
+	if v == runtime.Version() {
+		return ""
 	}
-	return fmt.Sprintf("https://play.golang.org/p/%s", p), nil
+	major, rest, _ := strings.Cut(v, ".")
+	minor, _, _ := strings.Cut(rest, ".")
+	minor, _, _ = strings.Cut(minor, "rc")
+	minor, _, _ = strings.Cut(minor, "beta")
+	return major + "." + minor
 }
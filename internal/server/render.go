@@ -9,7 +9,7 @@ import (
 	"go/token"
 	htemp "html/template"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"path"
@@ -18,6 +18,8 @@ import (
 	"text/template"
 
 	"git.sr.ht/~sircmpwn/gddo/internal/autodiscovery"
+	"git.sr.ht/~sircmpwn/gddo/internal/cache"
+	"git.sr.ht/~sircmpwn/gddo/internal/godoc"
 	"git.sr.ht/~sircmpwn/gddo/internal/proxy"
 	"git.sr.ht/~sircmpwn/gddo/internal/render"
 )
@@ -27,9 +29,14 @@ type Renderer struct {
 	fset    *token.FileSet
 	parser  *comment.Parser
 	project *autodiscovery.Project
+	links   godoc.Links
+	broken  map[string]bool
+	frags   *render.Fragments
 	ref     string
 	dir     string
 
+	importPath   string
+	modulePath   string
 	version      string
 	platform     string
 	showVersion  bool
@@ -42,9 +49,14 @@ func NewRenderer(p *Package, cfg *Config) *Renderer {
 		fset:    p.FileSet,
 		parser:  p.Parser(),
 		project: p.project,
+		links:   p.links,
+		broken:  p.BrokenLinks(),
+		frags:   p.fragments,
 		ref:     p.Reference,
 		dir:     p.innerPath,
 
+		importPath:   p.ImportPath,
+		modulePath:   p.ModulePath,
 		version:      p.Version,
 		platform:     p.Platform,
 		showVersion:  p.Version != p.LatestVersion,
@@ -70,11 +82,19 @@ func (r *Renderer) HTMLFuncs() template.FuncMap {
 		"render_func":   r.FuncString,
 		"render_decl":   r.DeclHTML,
 		"render_code":   r.CodeHTML,
+		"render_file":   r.FileHTML,
 		"source_link":   r.SourceLink,
+		"file_name":     r.FileName,
+		"line_link":     r.LineLink,
+		"source_url":    r.SourceURL,
+		"link_url":      r.LinkURL,
+		"type_link":     r.TypeLink,
 		"is_interface":  r.IsInterface,
+		"is_deprecated": r.IsDeprecated,
 		"play_id":       r.PlayID,
 		"view":          r.View,
 		"query":         r.Query,
+		"unexported":    r.UnexportedURL,
 		"breadcrumbs":   r.Breadcrumbs,
 		"relative_path": relativePath,
 		"platforms":     platformList,
@@ -83,7 +103,13 @@ func (r *Renderer) HTMLFuncs() template.FuncMap {
 
 // DocHTML returns formatted HTML for the doc comment text.
 func (r *Renderer) DocHTML(text string) htemp.HTML {
-	return render.DocHTML(r.parser.Parse(text))
+	return render.DocHTML(r.parser.Parse(text), r.isBroken)
+}
+
+// isBroken reports whether the doc link was found to be broken when the
+// package was fetched.
+func (r *Renderer) isBroken(l *comment.DocLink) bool {
+	return r.broken[godoc.LinkText(l)]
 }
 
 // FuncString formats a function declaration into a single line.
@@ -99,9 +125,14 @@ func (r *Renderer) FuncString(decl *ast.FuncDecl) string {
 
 // DeclHTML renders a Go declaration as HTML.
 func (r *Renderer) DeclHTML(decl ast.Decl, typ *doc.Type) htemp.HTML {
-	html, err := render.DeclHTML(r.fset, decl, typ)
+	if r.frags != nil {
+		if html, ok := r.frags.Decls[render.DeclKey(decl)]; ok {
+			return html
+		}
+	}
+	html, err := render.DeclHTML(r.fset, decl, typ, r.identURL)
 	if err != nil {
-		log.Printf("Error rendering ast.Decl: %v", err)
+		slog.Error("error rendering declaration", "error", err)
 		return "<pre>Error rendering declaration code</pre>"
 	}
 	return html
@@ -109,26 +140,175 @@ func (r *Renderer) DeclHTML(decl ast.Decl, typ *doc.Type) htemp.HTML {
 
 // CodeHTML renders example code as HTML.
 func (r *Renderer) CodeHTML(ex *doc.Example) htemp.HTML {
-	html, err := render.CodeHTML(r.fset, ex)
+	if r.frags != nil && ex.Code != nil {
+		if html, ok := r.frags.Examples[ex.Code.Pos()]; ok {
+			return html
+		}
+	}
+	html, err := render.CodeHTML(r.fset, ex, r.identURL)
 	if err != nil {
-		log.Printf("Error rendering *doc.Example: %v", err)
+		slog.Error("error rendering example", "error", err)
 		return "<pre>Error rendering example code</pre>"
 	}
 	return html
 }
 
-// SourceLink returns a source link for the given position.
+// FileHTML renders a whole source file, such as the file of an example, as
+// HTML.
+func (r *Renderer) FileHTML(f *godoc.File) htemp.HTML {
+	ex := &doc.Example{Code: f.AST, Comments: f.AST.Comments}
+	html, err := render.CodeHTML(r.fset, ex, r.identURL)
+	if err != nil {
+		slog.Error("error rendering file", "file", f.Name, "error", err)
+		return "<pre>Error rendering file</pre>"
+	}
+	return html
+}
+
+// RenderFragments pre-renders the declarations and examples of the package
+// documentation for use by the renderers of its pages.
+func RenderFragments(p *Package) *render.Fragments {
+	// The fragments are stored for the version of the package, so their
+	// links to source files always include it
+	r := &Renderer{
+		fset:        p.FileSet,
+		links:       p.links,
+		importPath:  p.ImportPath,
+		modulePath:  p.ModulePath,
+		version:     p.Version,
+		showVersion: true,
+	}
+	frags := render.NewFragments()
+	addDecl := func(decl ast.Decl, typ *doc.Type) {
+		frags.Decls[render.DeclKey(decl)] = r.DeclHTML(decl, typ)
+	}
+	addValues := func(values []*doc.Value) {
+		for _, v := range values {
+			addDecl(v.Decl, nil)
+		}
+	}
+	addFuncs := func(funcs []*doc.Func) {
+		for _, f := range funcs {
+			addDecl(f.Decl, nil)
+		}
+	}
+	addValues(p.Consts)
+	addValues(p.Vars)
+	addFuncs(p.Funcs)
+	for _, t := range p.Types {
+		addDecl(t.Decl, t)
+		addValues(t.Consts)
+		addValues(t.Vars)
+		addFuncs(t.Funcs)
+		addFuncs(t.Methods)
+	}
+	for _, ex := range p.examples {
+		if ex.Code != nil {
+			frags.Examples[ex.Code.Pos()] = r.CodeHTML(ex.Example)
+		}
+	}
+	return frags
+}
+
+// identURL returns the URL of the definition of the identifier, if it was
+// resolved when the package was fetched.
+func (r *Renderer) identURL(id *ast.Ident) string {
+	link, ok := r.links.Lookup(r.fset, id)
+	if !ok {
+		return ""
+	}
+	return r.LinkURL(link)
+}
+
+// LinkURL returns the URL of the given link.
+func (r *Renderer) LinkURL(link godoc.Link) string {
+	if link.Path == "" {
+		return ""
+	}
+	if link.File != "" {
+		return r.sourceURL(link.Path, link.File) + "#L" + strconv.Itoa(link.Line)
+	}
+	if link.Path == r.importPath && link.Fragment != "" {
+		return "#" + link.Fragment
+	}
+	u := url.URL{Path: "/" + link.Path, Fragment: link.Fragment}
+	return u.String()
+}
+
+// TypeLink returns a link to the documentation of the named type. Types of
+// other packages are qualified by their import path.
+func (r *Renderer) TypeLink(importPath, name string) htemp.HTML {
+	link := (&url.URL{Path: "/" + importPath, Fragment: name}).String()
+	text := importPath + "." + name
+	switch importPath {
+	case r.importPath:
+		link, text = "#"+name, name
+	case "builtin":
+		text = name
+	}
+	return htemp.HTML(fmt.Sprintf(`<a href="%s">%s</a>`,
+		htemp.HTMLEscapeString(link),
+		htemp.HTMLEscapeString(text)))
+}
+
+// SourceLink returns a source link for the given position. Positions are
+// linked to the project's source host if known, and to the built-in source
+// viewer otherwise.
 func (r *Renderer) SourceLink(p token.Pos, text string) htemp.HTML {
 	pos := r.fset.Position(p)
-	if r.project == nil || pos.Line == 0 {
+	return r.LineLink(pos.Filename, pos.Line, text)
+}
+
+// FileName returns the name of the source file containing the position.
+func (r *Renderer) FileName(p token.Pos) string {
+	return r.fset.Position(p).Filename
+}
+
+// LineLink returns a link to the given line of a source file of the
+// package.
+func (r *Renderer) LineLink(file string, line int, text string) htemp.HTML {
+	if line == 0 {
 		return htemp.HTML(htemp.HTMLEscapeString(text))
 	}
-	link := r.project.LineURL(r.ref, r.dir, pos.Filename, strconv.Itoa(pos.Line))
+	var link string
+	if r.project != nil {
+		link = r.project.LineURL(r.ref, r.dir, file, strconv.Itoa(line))
+	} else {
+		link = r.SourceURL(file) + "#L" + strconv.Itoa(line)
+	}
 	return htemp.HTML(fmt.Sprintf(`<a title="View Source" rel="noopener nofollow" href="%s">%s</a>`,
 		htemp.HTMLEscapeString(link),
 		htemp.HTMLEscapeString(text)))
 }
 
+// SourceURL returns the URL of the given source file of the package in the
+// built-in source viewer.
+func (r *Renderer) SourceURL(file string) string {
+	return r.sourceURL(r.importPath, file)
+}
+
+// sourceURL returns the URL of the named source file of the package. The
+// version is only added for packages of the same module, as the versions
+// of other modules are not known.
+func (r *Renderer) sourceURL(importPath, file string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	b.WriteString(importPath)
+	if r.showVersion && (importPath == r.importPath || cache.InModule(importPath, r.modulePath)) {
+		b.WriteByte('@')
+		b.WriteString(r.version)
+	}
+	b.WriteString("/-/src/")
+	b.WriteString(file)
+	return b.String()
+}
+
+// SourceHTML renders the named source file as HTML. files holds the source
+// files of the package directory.
+func (r *Renderer) SourceHTML(file string, files map[string][]byte) htemp.HTML {
+	return render.SourceHTML(file, files, r.SourceURL)
+}
+
 // IsInterface reports whether t is an interface type.
 func (r *Renderer) IsInterface(t *doc.Type) bool {
 	// TODO: Precompute this
@@ -147,6 +327,12 @@ func (r *Renderer) IsInterface(t *doc.Type) bool {
 	return isInterface
 }
 
+// IsDeprecated reports whether the doc comment text marks its declaration
+// as deprecated.
+func (r *Renderer) IsDeprecated(text string) bool {
+	return godoc.IsDeprecated(text)
+}
+
 // PlayID returns the play ID for the given example.
 func (r *Renderer) PlayID(ex *Example) string {
 	symbol := ex.Symbol
@@ -186,6 +372,19 @@ func (r *Renderer) View(importPath, view string) string {
 	return b.String()
 }
 
+// UnexportedURL returns a link to the current package which shows or hides
+// unexported declarations.
+func (r *Renderer) UnexportedURL(show bool) string {
+	link := r.View(r.importPath, "")
+	if !show {
+		return link
+	}
+	if strings.Contains(link, "?") {
+		return link + "&m=all"
+	}
+	return link + "?m=all"
+}
+
 // Query returns the current query, if necessary.
 func (r *Renderer) Query() string {
 	if !r.showPlatform {
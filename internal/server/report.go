@@ -0,0 +1,258 @@
+package server
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/doc/comment"
+	"go/token"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"git.sr.ht/~sircmpwn/gddo/internal/godoc"
+)
+
+// Weights of the checks of a package quality report, adding up to 100.
+const (
+	reportPackageDoc = 20 // package comment
+	reportCoverage   = 40 // documented exported identifiers
+	reportStyle      = 20 // doc comments beginning with the identifier name
+	reportLinks      = 10 // resolved doc links
+	reportExamples   = 10 // exported functions and types with examples
+)
+
+// A Report assesses the quality of the documentation of a package.
+type Report struct {
+	Score int // overall score, from 0 to 100
+
+	NoPackageDoc    bool         // the package comment is missing
+	Undocumented    []ReportItem // exported identifiers without doc comments
+	BadDocStart     []ReportItem // doc comments not beginning with the name
+	BrokenLinks     []ReportItem // doc links which could not be resolved
+	MissingExamples []ReportItem // exported functions and types without examples
+
+	// Other problems found when the package was fetched
+	Warnings []godoc.Warning
+
+	identifiers int // exported identifiers
+	documented  int // documented functions, types and methods
+	links       int // resolved doc links
+	exampled    int // functions and types with examples
+	exampleable int // functions and types which could have examples
+}
+
+// A ReportItem is an identifier or doc comment flagged by a report.
+type ReportItem struct {
+	Name   string
+	Pos    token.Pos
+	Detail string
+
+	link string // text of a broken doc link
+}
+
+// A ReportSection is a list of items flagged by one check of a report.
+type ReportSection struct {
+	ID    string       // anchor of the section
+	Title string       // title of the section
+	Empty string       // text shown if no items were flagged
+	Items []ReportItem // flagged items
+}
+
+// Sections returns the sections of the report for display.
+func (r *Report) Sections() []ReportSection {
+	return []ReportSection{
+		{"undocumented", "Undocumented identifiers",
+			"All exported identifiers are documented.", r.Undocumented},
+		{"doc-start", "Doc comments not beginning with the name",
+			"All doc comments begin with the name of the identifier.", r.BadDocStart},
+		{"broken-links", "Broken doc links",
+			"No broken doc links were found.", r.BrokenLinks},
+		{"missing-examples", "Functions and types without examples",
+			"All exported functions and types have examples.", r.MissingExamples},
+	}
+}
+
+// NewReport returns the quality report for the package.
+func NewReport(p *Package) *Report {
+	r := &Report{NoPackageDoc: strings.TrimSpace(p.Doc) == ""}
+	parser := p.Parser()
+	r.checkLinks(parser, p.Name, p.Doc, token.NoPos)
+
+	if p.Name != "main" {
+		r.checkValues(parser, p.Consts)
+		r.checkValues(parser, p.Vars)
+		for _, f := range p.Funcs {
+			r.checkFunc(parser, p, f, "")
+		}
+		for _, t := range p.Types {
+			r.checkType(parser, p, t)
+		}
+	}
+
+	// Include the broken links to other packages found when the package
+	// was fetched
+	reported := make(map[[2]string]bool)
+	for _, item := range r.BrokenLinks {
+		reported[[2]string{item.Name, item.link}] = true
+	}
+	for _, w := range p.Warnings {
+		if w.Link == "" {
+			r.Warnings = append(r.Warnings, w)
+			continue
+		}
+		if !reported[[2]string{w.Name, w.Link}] {
+			r.BrokenLinks = append(r.BrokenLinks, ReportItem{
+				Name:   w.Name,
+				Pos:    p.filePos(w.File, w.Line),
+				Detail: w.Message,
+			})
+		}
+	}
+	r.score()
+	return r
+}
+
+func (r *Report) checkValues(parser *comment.Parser, values []*doc.Value) {
+	for _, v := range values {
+		for _, spec := range v.Decl.Specs {
+			vs := spec.(*ast.ValueSpec)
+			specDoc := v.Doc != "" || vs.Doc != nil || vs.Comment != nil
+			for _, name := range vs.Names {
+				if !token.IsExported(name.Name) {
+					continue
+				}
+				r.identifiers++
+				if !specDoc {
+					r.Undocumented = append(r.Undocumented, ReportItem{Name: name.Name, Pos: name.Pos()})
+				}
+			}
+		}
+		if v.Doc != "" && len(v.Names) > 0 {
+			r.checkLinks(parser, v.Names[0], v.Doc, v.Decl.Pos())
+		}
+	}
+}
+
+func (r *Report) checkFunc(parser *comment.Parser, p *Package, f *doc.Func, recv string) {
+	if !token.IsExported(f.Name) || f.Level > 0 {
+		// Promoted methods are documented by their original type
+		return
+	}
+	name := f.Name
+	if recv != "" {
+		name = recv + "." + f.Name
+	} else {
+		r.exampleable++
+		if len(p.ObjExamples(f)) > 0 {
+			r.exampled++
+		} else {
+			r.MissingExamples = append(r.MissingExamples, ReportItem{Name: name, Pos: f.Decl.Name.Pos()})
+		}
+	}
+	r.checkDoc(parser, name, f.Name, f.Doc, f.Decl.Name.Pos(), false)
+}
+
+func (r *Report) checkType(parser *comment.Parser, p *Package, t *doc.Type) {
+	if !token.IsExported(t.Name) {
+		return
+	}
+	pos := t.Decl.Pos()
+	for _, spec := range t.Decl.Specs {
+		if ts := spec.(*ast.TypeSpec); ts.Name.Name == t.Name {
+			pos = ts.Name.Pos()
+		}
+	}
+	r.exampleable++
+	if len(p.ObjExamples(t)) > 0 {
+		r.exampled++
+	} else {
+		r.MissingExamples = append(r.MissingExamples, ReportItem{Name: t.Name, Pos: pos})
+	}
+	r.checkDoc(parser, t.Name, t.Name, t.Doc, pos, true)
+
+	r.checkValues(parser, t.Consts)
+	r.checkValues(parser, t.Vars)
+	for _, f := range t.Funcs {
+		r.checkFunc(parser, p, f, "")
+	}
+	for _, m := range t.Methods {
+		r.checkFunc(parser, p, m, t.Name)
+	}
+}
+
+// checkDoc checks the doc comment of a function, method or type. Following
+// the Go conventions, the doc comment of a type may begin with an article.
+func (r *Report) checkDoc(parser *comment.Parser, name, ident, text string, pos token.Pos, article bool) {
+	r.identifiers++
+	if text == "" {
+		r.Undocumented = append(r.Undocumented, ReportItem{Name: name, Pos: pos})
+		return
+	}
+	r.documented++
+	first := text
+	if article {
+		for _, a := range []string{"A ", "An ", "The "} {
+			if rest, ok := strings.CutPrefix(text, a); ok {
+				first = rest
+				break
+			}
+		}
+	}
+	if !startsWithWord(first, ident) {
+		word, _, _ := strings.Cut(strings.TrimSpace(text), " ")
+		r.BadDocStart = append(r.BadDocStart, ReportItem{
+			Name:   name,
+			Pos:    pos,
+			Detail: `begins with "` + word + `" instead of "` + ident + `"`,
+		})
+	}
+	r.checkLinks(parser, name, text, pos)
+}
+
+// startsWithWord reports whether text begins with the given word.
+func startsWithWord(text, word string) bool {
+	rest, ok := strings.CutPrefix(text, word)
+	if !ok {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(rest)
+	return rest == "" || !unicode.IsLetter(next) && !unicode.IsDigit(next) && next != '_'
+}
+
+// checkLinks counts the doc links in the doc comment text and reports those
+// which could not be resolved.
+func (r *Report) checkLinks(parser *comment.Parser, name, text string, pos token.Pos) {
+	if text == "" {
+		return
+	}
+	links, unresolved := godoc.DocLinks(parser.Parse(text))
+	r.links += len(links)
+	for _, link := range unresolved {
+		r.BrokenLinks = append(r.BrokenLinks, ReportItem{
+			Name:   name,
+			Pos:    pos,
+			Detail: "unresolved link [" + link + "]",
+			link:   link,
+		})
+	}
+}
+
+// score computes the overall score of the report.
+func (r *Report) score() {
+	ratio := func(n, total int) float64 {
+		if total == 0 {
+			return 1
+		}
+		return float64(n) / float64(total)
+	}
+	score := 0.0
+	if !r.NoPackageDoc {
+		score += reportPackageDoc
+	}
+	score += reportCoverage * ratio(r.identifiers-len(r.Undocumented), r.identifiers)
+	score += reportStyle * ratio(r.documented-len(r.BadDocStart), r.documented)
+	score += reportLinks * ratio(r.links, r.links+len(r.BrokenLinks))
+	score += reportExamples * ratio(r.exampled, r.exampleable)
+	r.Score = int(math.Round(score))
+}
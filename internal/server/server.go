@@ -4,20 +4,31 @@ package server
 import (
 	"context"
 	"net/http"
+	"net/netip"
 	"strings"
 	"sync"
 	"time"
 
 	"git.sr.ht/~sircmpwn/gddo/internal"
+	"git.sr.ht/~sircmpwn/gddo/internal/cache"
 	"git.sr.ht/~sircmpwn/gddo/internal/database"
+	"git.sr.ht/~sircmpwn/gddo/internal/httputil"
+	"git.sr.ht/~sircmpwn/gddo/internal/playground"
 	"git.sr.ht/~sircmpwn/gddo/internal/proxy"
+	"git.sr.ht/~sircmpwn/gddo/internal/ratelimit"
+	"git.sr.ht/~sircmpwn/gddo/internal/sandbox"
 	"git.sr.ht/~sircmpwn/gddo/internal/stdlib"
+	"git.sr.ht/~sircmpwn/gddo/internal/webhook"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
 )
 
+// defaultFetchRate is the default number of module fetches per minute
+// allowed for each client behind trusted proxies.
+const defaultFetchRate = 10
+
 // The Go documentation server.
 type Server struct {
 	cfg        *Config
@@ -26,10 +37,28 @@ type Server struct {
 	templates  TemplateMap
 	statusSVG  http.Handler
 	sources    internal.SourceList
+	playground *playground.Client
+	sandbox    sandbox.Sandbox
+	cache      *cache.Cache
+	webhooks   *webhook.Dispatcher
+	trusted    []netip.Prefix
 	fetches    sync.Map
+	detecting  sync.Map
 
-	// A semaphore to limit concurrent module fetches.
+	// Semaphores to limit concurrent module fetches, and concurrent
+	// fetches of packages linked from documentation.
 	moduleFetchSem chan struct{}
+	linkedFetchSem chan struct{}
+
+	// A semaphore to limit concurrent example runs.
+	runSem chan struct{}
+
+	implementersCache *cache.TTLMap[implementersKey, map[string]*database.Implementers]
+	feedCache         *cache.TTLMap[feedKey, []feedVersion]
+
+	// Per-client limits of fetches and refresh form submissions.
+	fetchLimiter   *ratelimit.Limiter
+	refreshLimiter *ratelimit.Limiter
 
 	// Prometheus metrics
 	metrics struct {
@@ -40,6 +69,10 @@ type Server struct {
 		httpPackageTotal prometheus.Counter
 		httpRefreshTotal prometheus.Counter
 		bgRefreshTotal   prometheus.Counter
+		httpCacheHits    prometheus.Counter
+		httpHookTotal    prometheus.Counter
+		httpRateLimited  prometheus.Counter
+		fetchFailureHits prometheus.Counter
 	}
 }
 
@@ -63,6 +96,16 @@ func New(cfg *Config) (*Server, error) {
 		httpClient:     httpClient,
 		templates:      make(TemplateMap),
 		moduleFetchSem: make(chan struct{}, 30),
+		linkedFetchSem: make(chan struct{}, 2),
+		fetchLimiter:   ratelimit.New(fetchRate(cfg), cfg.FetchBurst),
+		refreshLimiter: ratelimit.New(cfg.RefreshRate, cfg.RefreshBurst),
+	}
+	s.implementersCache = cache.NewTTLMap[implementersKey, map[string]*database.Implementers](
+		implementersTTL, maxCachedImplementers)
+	s.feedCache = cache.NewTTLMap[feedKey, []feedVersion](feedTTL, maxCachedFeeds)
+	s.trusted, err = httputil.ParsePrefixes(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
 	}
 
 	s.sources = append(s.sources,
@@ -73,6 +116,39 @@ func New(cfg *Config) (*Server, error) {
 		},
 	)
 
+	s.playground = playground.New(cfg.PlaygroundURL, cfg.PlaygroundView, httpClient)
+	if s.playground != nil {
+		s.playground.UserAgent = cfg.UserAgent
+	}
+	if cfg.RunCommand != "" {
+		cmd, err := sandbox.ParseCommand(cfg.RunCommand, cfg.RunTimeout)
+		if err != nil {
+			return nil, err
+		}
+		cmd.CacheDir = cfg.RunCacheDir
+		cmd.Limits.Memory = int64(cfg.RunMemory) * megabyte
+		cmd.Limits.Processes = cfg.RunProcesses
+		s.sandbox = cmd
+		s.runSem = make(chan struct{}, max(cfg.RunConcurrency, 1))
+	}
+	if cfg.CacheSize > 0 {
+		var store cache.Store
+		if cfg.CacheDir != "" {
+			store = cache.FileStore{Dir: cfg.CacheDir}
+		}
+		s.cache = cache.New(int64(cfg.CacheSize)*megabyte, cfg.CacheTTL, store)
+	}
+	if cfg.Webhooks != "" {
+		subs, err := webhook.Load(cfg.Webhooks)
+		if err != nil {
+			return nil, err
+		}
+		s.webhooks = webhook.New(subs, httpClient)
+		if s.webhooks != nil {
+			s.webhooks.UserAgent = cfg.UserAgent
+		}
+	}
+
 	s.metrics.modulesTotal = promauto.NewCounterFunc(prometheus.CounterOpts{
 		Name: "gddo_modules_total",
 		Help: "Total number of modules indexed",
@@ -109,10 +185,40 @@ func New(cfg *Config) (*Server, error) {
 		Name: "gddo_background_refreshes_total",
 		Help: "Total number of background module refreshes",
 	})
+	s.metrics.httpCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gddo_http_cache_hits_total",
+		Help: "Total number of HTTP package requests served from the page cache",
+	})
+	s.metrics.httpHookTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gddo_http_hook_refreshes_total",
+		Help: "Total number of accepted refresh webhook requests",
+	})
+	s.metrics.httpRateLimited = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gddo_http_rate_limited_total",
+		Help: "Total number of HTTP requests denied by rate limits",
+	})
+	s.metrics.fetchFailureHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gddo_fetch_failure_hits_total",
+		Help: "Total number of fetches skipped because a recent failure was remembered",
+	})
 
 	return s, nil
 }
 
+// fetchRate returns the configured number of module fetches per minute
+// allowed for each client. By default, fetches are only limited if trusted
+// proxies are configured: otherwise the clients of a reverse proxy, which
+// can't be told apart, would share its limit.
+func fetchRate(cfg *Config) float64 {
+	if cfg.FetchRate >= 0 {
+		return cfg.FetchRate
+	}
+	if cfg.TrustedProxies != "" {
+		return defaultFetchRate
+	}
+	return 0
+}
+
 // Parses the provided request path, returning the package import path and version.
 func (s *Server) parseRequestPath(ctx context.Context, path string) (string, string, error) {
 	// Trim leading forward slash
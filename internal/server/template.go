@@ -82,8 +82,12 @@ func (s *Server) parseHTMLTemplates(m TemplateMap, files *httputil.FileServer) e
 		"versions.html",
 		"platforms.html",
 		"imports.html",
+		"report.html",
+		"license.html",
 		"notfound.html",
 		"search.html",
+		"source.html",
+		"testapi.html",
 		"tools.html",
 	}
 	funcs := htemp.FuncMap{
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"io/fs"
 	"time"
+
+	"golang.org/x/mod/semver"
 )
 
 const LatestVersion = "latest"
@@ -37,9 +39,40 @@ type Module struct {
 	LatestVersion string
 	Versions      []string
 	Deprecated    string
+	Retractions   []Retraction
+	ZipSize       int64     // size of the module zip file in bytes, if known
 	Updated       time.Time // TODO: remove this
 }
 
+// Retraction describes an inclusive range of retracted module versions,
+// as specified by a retract directive in the module's go.mod file.
+type Retraction struct {
+	Low       string
+	High      string
+	Rationale string
+}
+
+// Contains reports whether the given version is in the retracted range.
+func (r *Retraction) Contains(version string) bool {
+	return semver.Compare(r.Low, version) <= 0 && semver.Compare(version, r.High) <= 0
+}
+
+// Retraction returns the retraction which covers the given version,
+// or nil if the version is not retracted.
+func (m *Module) Retraction(version string) *Retraction {
+	for i := range m.Retractions {
+		if m.Retractions[i].Contains(version) {
+			return &m.Retractions[i]
+		}
+	}
+	return nil
+}
+
+// IsRetracted reports whether the given version has been retracted.
+func (m *Module) IsRetracted(version string) bool {
+	return m.Retraction(version) != nil
+}
+
 // Source represents a source of Go modules.
 type Source interface {
 	Module(modulePath, version string) (*Module, error)
@@ -0,0 +1,207 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// ErrNoRepository is returned by ParsePush for payloads which identify
+// neither a repository nor a module.
+var ErrNoRepository = errors.New("payload does not identify a repository")
+
+// A Push is a push of tags to a repository, received from a forge.
+type Push struct {
+	// Repository is the path of the repository without a scheme, such as
+	// "github.com/owner/repo". It has the case of the repository URL,
+	// which may differ from the case of the module path.
+	Repository string
+
+	// ModulePath is the path of the module at the root of the repository,
+	// if it differs from the repository path.
+	ModulePath string
+
+	// Tags are the pushed tags.
+	Tags []string
+}
+
+// payload covers the push payloads of the supported forges:
+//
+//   - GitHub and Gitea push, create and release events
+//   - sourcehut repo:post-update events
+//   - generic payloads of the form {"module_path": ..., "version": ...}
+type payload struct {
+	ModulePath string `json:"module_path"`
+	Version    string `json:"version"`
+
+	Ref        string `json:"ref"`
+	RefType    string `json:"ref_type"`
+	Deleted    bool   `json:"deleted"`
+	Repository struct {
+		HTMLURL  string `json:"html_url"`
+		CloneURL string `json:"clone_url"`
+		Name     string `json:"name"`
+		Owner    struct {
+			CanonicalName string `json:"canonical_name"`
+		} `json:"owner"`
+	} `json:"repository"`
+	Release struct {
+		TagName string `json:"tag_name"`
+	} `json:"release"`
+
+	Refs []struct {
+		Name string `json:"name"`
+	} `json:"refs"`
+}
+
+// ParsePush parses the JSON payload of a push event.
+func ParsePush(body []byte) (*Push, error) {
+	var p payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+
+	push := &Push{ModulePath: p.ModulePath}
+	if p.ModulePath != "" {
+		// Generic payload. An empty version refers to the latest version.
+		if p.Version != "" {
+			push.Tags = append(push.Tags, p.Version)
+		}
+		return push, nil
+	}
+
+	switch {
+	case p.Repository.HTMLURL != "":
+		push.Repository = repositoryPath(p.Repository.HTMLURL)
+	case p.Repository.CloneURL != "":
+		push.Repository = repositoryPath(p.Repository.CloneURL)
+	case p.Repository.Owner.CanonicalName != "" && p.Repository.Name != "":
+		push.Repository = "git.sr.ht/" + p.Repository.Owner.CanonicalName + "/" + p.Repository.Name
+	default:
+		return nil, ErrNoRepository
+	}
+
+	switch {
+	case p.Release.TagName != "":
+		push.Tags = append(push.Tags, p.Release.TagName)
+	case p.RefType == "tag":
+		push.Tags = append(push.Tags, p.Ref)
+	case strings.HasPrefix(p.Ref, "refs/tags/") && !p.Deleted:
+		push.Tags = append(push.Tags, strings.TrimPrefix(p.Ref, "refs/tags/"))
+	}
+	for _, ref := range p.Refs {
+		if tag, ok := strings.CutPrefix(ref.Name, "refs/tags/"); ok {
+			push.Tags = append(push.Tags, tag)
+		}
+	}
+	return push, nil
+}
+
+// repositoryPath returns the path of the repository with the given URL.
+func repositoryPath(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	p := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	return path.Join(u.Host, p)
+}
+
+// A ModuleVersion is a version of a module to be fetched.
+type ModuleVersion struct {
+	Path    string
+	Version string // empty for the latest version
+}
+
+// Modules returns the module versions corresponding to the pushed tags.
+// Tags of modules in subdirectories of the repository are prefixed with
+// the subdirectory, e.g. "sub/v1.2.3". Tags which are not semantic versions
+// are ignored. For generic payloads without a version, Modules returns the
+// latest version of the module.
+func (p *Push) Modules() []ModuleVersion {
+	root := p.ModulePath
+	if root == "" {
+		root = p.Repository
+	}
+	if root == "" {
+		return nil
+	}
+	if p.ModulePath != "" && len(p.Tags) == 0 {
+		if module.CheckPath(root) != nil {
+			return nil
+		}
+		return []ModuleVersion{{Path: root}}
+	}
+
+	var mods []ModuleVersion
+	seen := make(map[ModuleVersion]bool)
+	for _, tag := range p.Tags {
+		modPath := root
+		version := tag
+		if i := strings.LastIndex(tag, "/"); i >= 0 {
+			modPath = root + "/" + tag[:i]
+			version = tag[i+1:]
+		}
+		if !semver.IsValid(version) {
+			continue
+		}
+		if major := semver.Major(version); major != "v0" && major != "v1" {
+			if _, pathMajor, ok := module.SplitPathVersion(modPath); ok && pathMajor == "" {
+				modPath += "/" + major
+			}
+		}
+		if module.CheckPath(modPath) != nil {
+			continue
+		}
+		mv := ModuleVersion{Path: modPath, Version: version}
+		if !seen[mv] {
+			seen[mv] = true
+			mods = append(mods, mv)
+		}
+	}
+	return mods
+}
+
+// Verify reports whether the request carrying the body is authenticated
+// with the secret. Requests are authenticated with an HMAC-SHA256 of the
+// body in the X-Hub-Signature-256 (GitHub), X-Gitea-Signature (Gitea) or
+// X-Gddo-Signature header, or, for forges which cannot sign payloads, with
+// the secret as a bearer token.
+func Verify(req *http.Request, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	sum := mac.Sum(nil)
+	checkMAC := func(sig string) bool {
+		b, err := hex.DecodeString(sig)
+		return err == nil && hmac.Equal(b, sum)
+	}
+	checkToken := func(token string) bool {
+		return hmac.Equal([]byte(token), []byte(secret))
+	}
+
+	if sig, ok := strings.CutPrefix(req.Header.Get("X-Hub-Signature-256"), "sha256="); ok {
+		return checkMAC(sig)
+	}
+	if sig := req.Header.Get("X-Gitea-Signature"); sig != "" {
+		return checkMAC(sig)
+	}
+	if sig, ok := strings.CutPrefix(req.Header.Get(SignatureHeader), "sha256="); ok {
+		return checkMAC(sig)
+	}
+	if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+		return checkToken(token)
+	}
+	return false
+}
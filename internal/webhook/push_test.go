@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePush(t *testing.T) {
+	for _, test := range []struct {
+		name, body string
+		want       []ModuleVersion
+	}{
+		{
+			"github push",
+			`{"ref": "refs/tags/v1.2.0", "repository": {"html_url": "https://github.com/owner/repo"}}`,
+			[]ModuleVersion{{"github.com/owner/repo", "v1.2.0"}},
+		},
+		{
+			"github branch push",
+			`{"ref": "refs/heads/main", "repository": {"html_url": "https://github.com/owner/repo"}}`,
+			nil,
+		},
+		{
+			"github tag deletion",
+			`{"ref": "refs/tags/v1.2.0", "deleted": true, "repository": {"html_url": "https://github.com/owner/repo"}}`,
+			nil,
+		},
+		{
+			"github release",
+			`{"action": "published", "release": {"tag_name": "v2.0.0"}, "repository": {"html_url": "https://github.com/owner/repo"}}`,
+			[]ModuleVersion{{"github.com/owner/repo/v2", "v2.0.0"}},
+		},
+		{
+			"gitea create",
+			`{"ref": "sub/v0.3.0", "ref_type": "tag", "repository": {"clone_url": "https://gitea.example.com/owner/repo.git"}}`,
+			[]ModuleVersion{{"gitea.example.com/owner/repo/sub", "v0.3.0"}},
+		},
+		{
+			"sourcehut",
+			`{"refs": [{"name": "refs/heads/master"}, {"name": "refs/tags/v1.0.1"}, {"name": "refs/tags/nightly"}],
+			  "repository": {"name": "repo", "owner": {"canonical_name": "~user"}}}`,
+			[]ModuleVersion{{"git.sr.ht/~user/repo", "v1.0.1"}},
+		},
+		{
+			"generic",
+			`{"module_path": "example.org/m/v3", "version": "v3.1.0"}`,
+			[]ModuleVersion{{"example.org/m/v3", "v3.1.0"}},
+		},
+		{
+			"generic latest",
+			`{"module_path": "example.org/m"}`,
+			[]ModuleVersion{{"example.org/m", ""}},
+		},
+	} {
+		push, err := ParsePush([]byte(test.body))
+		if err != nil {
+			t.Errorf("%s: ParsePush: %v", test.name, err)
+			continue
+		}
+		if got := push.Modules(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Modules = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{`not json`, `{"ref": "refs/tags/v1.0.0"}`} {
+		if _, err := ParsePush([]byte(bad)); err == nil {
+			t.Errorf("ParsePush(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(`{"module_path": "example.org/m"}`)
+	sig := Sign(secret, body)
+	for _, test := range []struct {
+		target, header, value string
+		want                  bool
+	}{
+		{"/", "X-Hub-Signature-256", sig, true},
+		{"/", "X-Hub-Signature-256", Sign("wrong", body), false},
+		{"/", "X-Gitea-Signature", strings.TrimPrefix(sig, "sha256="), true},
+		{"/", SignatureHeader, sig, true},
+		{"/", "Authorization", "Bearer " + secret, true},
+		{"/", "Authorization", "Bearer wrong", false},
+		{"/?token=" + secret, "", "", false},
+		{"/", "", "", false},
+	} {
+		req := httptest.NewRequest("POST", test.target, nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		if got := Verify(req, body, secret); got != test.want {
+			t.Errorf("Verify(%s, %s: %s) = %v, want %v", test.target, test.header, test.value, got, test.want)
+		}
+	}
+}
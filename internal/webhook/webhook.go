@@ -0,0 +1,276 @@
+// Package webhook implements webhooks: it delivers notifications of changes
+// to modules to subscribers, and parses push events received from forges.
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"git.sr.ht/~sircmpwn/gddo/internal"
+)
+
+// Event types.
+const (
+	// A new latest version of the module was published.
+	EventVersion = "version"
+	// The module was deprecated.
+	EventDeprecated = "deprecated"
+	// Versions of the module were retracted.
+	EventRetracted = "retracted"
+)
+
+// SignatureHeader is the HTTP header carrying the signature of a delivery.
+// Its value is "sha256=" followed by the hex-encoded HMAC-SHA256 of the
+// request body, keyed with the secret of the subscription.
+const SignatureHeader = "X-Gddo-Signature"
+
+// An Event is a change to a module, delivered as the JSON body of a POST
+// request.
+type Event struct {
+	Type          string `json:"type"`
+	ModulePath    string `json:"module_path"`
+	LatestVersion string `json:"latest_version"`
+	// The previous latest version, for version events.
+	PreviousVersion string `json:"previous_version,omitempty"`
+	// The deprecation message, for deprecated events.
+	Deprecated string `json:"deprecated,omitempty"`
+	// The new retractions, for retracted events.
+	Retractions []internal.Retraction `json:"retractions,omitempty"`
+	Time        time.Time             `json:"time"`
+}
+
+// Changes returns the events for the changes from the module prev to mod.
+// There are no events for modules seen for the first time.
+func Changes(prev, mod *internal.Module) []Event {
+	if prev == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	var events []Event
+	if mod.LatestVersion != prev.LatestVersion {
+		events = append(events, Event{
+			Type:            EventVersion,
+			ModulePath:      mod.ModulePath,
+			LatestVersion:   mod.LatestVersion,
+			PreviousVersion: prev.LatestVersion,
+			Time:            now,
+		})
+	}
+	if mod.Deprecated != "" && mod.Deprecated != prev.Deprecated {
+		events = append(events, Event{
+			Type:          EventDeprecated,
+			ModulePath:    mod.ModulePath,
+			LatestVersion: mod.LatestVersion,
+			Deprecated:    mod.Deprecated,
+			Time:          now,
+		})
+	}
+	seen := make(map[internal.Retraction]bool)
+	for _, r := range prev.Retractions {
+		seen[r] = true
+	}
+	var retractions []internal.Retraction
+	for _, r := range mod.Retractions {
+		if !seen[r] {
+			retractions = append(retractions, r)
+		}
+	}
+	if len(retractions) > 0 {
+		events = append(events, Event{
+			Type:          EventRetracted,
+			ModulePath:    mod.ModulePath,
+			LatestVersion: mod.LatestVersion,
+			Retractions:   retractions,
+			Time:          now,
+		})
+	}
+	return events
+}
+
+// A Subscription receives the events of modules matching a module path
+// prefix.
+type Subscription struct {
+	// Prefix is a module path prefix, which matches whole path elements.
+	// The empty prefix matches all modules.
+	Prefix string
+	URL    string
+	Secret string
+}
+
+// Matches reports whether the subscription receives the events of the
+// module.
+func (s *Subscription) Matches(modulePath string) bool {
+	prefix := strings.TrimSuffix(s.Prefix, "/")
+	return prefix == "" || modulePath == prefix ||
+		strings.HasPrefix(modulePath, prefix+"/")
+}
+
+// Parse parses subscriptions, one per line, each consisting of a module
+// path prefix, a URL and a secret separated by white space. A prefix of "*"
+// matches all modules. Blank lines and lines starting with '#' are ignored.
+func Parse(r io.Reader) ([]Subscription, error) {
+	var subs []Subscription
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected prefix, URL and secret", n)
+		}
+		if !strings.HasPrefix(fields[1], "http://") && !strings.HasPrefix(fields[1], "https://") {
+			return nil, fmt.Errorf("line %d: invalid URL %q", n, fields[1])
+		}
+		prefix := fields[0]
+		if prefix == "*" {
+			prefix = ""
+		}
+		subs = append(subs, Subscription{Prefix: prefix, URL: fields[1], Secret: fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// Load reads subscriptions from the named file. See [Parse] for the format.
+func Load(name string) ([]Subscription, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	subs, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return subs, nil
+}
+
+// Sign returns the signature of the body with the secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher delivers events to subscriptions.
+type Dispatcher struct {
+	Subscriptions []Subscription
+
+	// Client used for HTTP requests.
+	HTTPClient *http.Client
+
+	// UserAgent used for HTTP requests, if non-empty.
+	UserAgent string
+
+	// MaxAttempts is the maximum number of delivery attempts of an event
+	// to a subscription.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry of a failed delivery.
+	// The delay doubles with each retry.
+	Backoff time.Duration
+}
+
+// New returns a dispatcher for the subscriptions with the default retry
+// policy, or nil if there are no subscriptions.
+func New(subs []Subscription, httpClient *http.Client) *Dispatcher {
+	if len(subs) == 0 {
+		return nil
+	}
+	return &Dispatcher{
+		Subscriptions: subs,
+		HTTPClient:    httpClient,
+		MaxAttempts:   5,
+		Backoff:       10 * time.Second,
+	}
+}
+
+// Dispatch delivers the events to the matching subscriptions in the
+// background. Failed deliveries are logged. A nil dispatcher does nothing.
+func (d *Dispatcher) Dispatch(events []Event) {
+	if d == nil {
+		return
+	}
+	for _, ev := range events {
+		for i := range d.Subscriptions {
+			sub := &d.Subscriptions[i]
+			if !sub.Matches(ev.ModulePath) {
+				continue
+			}
+			go func(ev Event) {
+				if err := d.Deliver(context.Background(), sub, ev); err != nil {
+					slog.Warn("error delivering webhook event", "event", ev.Type,
+						"module", ev.ModulePath, "url", sub.URL, "error", err)
+				}
+			}(ev)
+		}
+	}
+}
+
+// Deliver delivers the event to the subscription, retrying failed attempts
+// with exponential backoff. Client errors other than 429 Too Many Requests
+// are not retried.
+func (d *Dispatcher) Deliver(ctx context.Context, sub *Subscription, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	backoff := d.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(ctx, sub, body)
+		if err == nil || !retry || attempt >= d.MaxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// post posts the body to the subscription and reports whether a failed
+// delivery may be retried.
+func (d *Dispatcher) post(ctx context.Context, sub *Subscription, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, body))
+	if d.UserAgent != "" {
+		req.Header.Set("User-Agent", d.UserAgent)
+	}
+	client := d.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status: %s", resp.Status)
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"git.sr.ht/~sircmpwn/gddo/internal"
+)
+
+func TestChanges(t *testing.T) {
+	prev := &internal.Module{
+		ModulePath:    "example.org/m",
+		LatestVersion: "v1.0.0",
+		Retractions:   []internal.Retraction{{Low: "v0.1.0", High: "v0.1.0"}},
+	}
+	if events := Changes(nil, prev); events != nil {
+		t.Errorf("Changes of new module = %v, want none", events)
+	}
+	if events := Changes(prev, prev); events != nil {
+		t.Errorf("Changes of unchanged module = %v, want none", events)
+	}
+
+	mod := *prev
+	mod.LatestVersion = "v1.1.0"
+	mod.Deprecated = "use example.org/m/v2"
+	mod.Retractions = append(mod.Retractions, internal.Retraction{Low: "v1.0.0", High: "v1.0.0", Rationale: "broken"})
+	events := Changes(prev, &mod)
+	var types []string
+	for _, ev := range events {
+		types = append(types, ev.Type)
+	}
+	if got, want := strings.Join(types, ","), "version,deprecated,retracted"; got != want {
+		t.Fatalf("Changes types = %s, want %s", got, want)
+	}
+	if ev := events[0]; ev.LatestVersion != "v1.1.0" || ev.PreviousVersion != "v1.0.0" {
+		t.Errorf("version event = %+v", ev)
+	}
+	if ev := events[2]; len(ev.Retractions) != 1 || ev.Retractions[0].Rationale != "broken" {
+		t.Errorf("retracted event = %+v", ev)
+	}
+}
+
+func TestParse(t *testing.T) {
+	subs, err := Parse(strings.NewReader(`
+# comment
+example.org/m https://hooks.example.com/a s3cret
+*	http://localhost:8080/b	other
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 2 {
+		t.Fatalf("Parse returned %d subscriptions, want 2", len(subs))
+	}
+	if subs[0].Prefix != "example.org/m" || subs[0].URL != "https://hooks.example.com/a" || subs[0].Secret != "s3cret" {
+		t.Errorf("subs[0] = %+v", subs[0])
+	}
+	if subs[1].Prefix != "" {
+		t.Errorf("subs[1].Prefix = %q, want empty", subs[1].Prefix)
+	}
+
+	for _, bad := range []string{"example.org/m https://example.com", "example.org/m ftp://example.com s"} {
+		if _, err := Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	for _, test := range []struct {
+		prefix, path string
+		want         bool
+	}{
+		{"", "example.org/m", true},
+		{"example.org", "example.org/m", true},
+		{"example.org/", "example.org/m", true},
+		{"example.org/m", "example.org/m", true},
+		{"example.org/m", "example.org/m/v2", true},
+		{"example.org/m", "example.org/mod", false},
+		{"example.org/m/v2", "example.org/m", false},
+	} {
+		sub := &Subscription{Prefix: test.prefix}
+		if got := sub.Matches(test.path); got != test.want {
+			t.Errorf("Subscription{Prefix: %q}.Matches(%q) = %v, want %v",
+				test.prefix, test.path, got, test.want)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		got      Event
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if sig := r.Header.Get(SignatureHeader); sig != Sign("s3cret", body) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	d := New([]Subscription{{URL: srv.URL, Secret: "s3cret"}}, srv.Client())
+	d.Backoff = time.Millisecond
+	ev := Event{Type: EventVersion, ModulePath: "example.org/m", LatestVersion: "v1.1.0"}
+	if err := d.Deliver(context.Background(), &d.Subscriptions[0], ev); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Deliver made %d attempts, want 3", attempts)
+	}
+	if got.ModulePath != ev.ModulePath || got.LatestVersion != ev.LatestVersion {
+		t.Errorf("receiver got %+v, want %+v", got, ev)
+	}
+
+	// Client errors are not retried
+	attempts = 0
+	d.Subscriptions[0].Secret = "wrong"
+	if err := d.Deliver(context.Background(), &d.Subscriptions[0], ev); err == nil {
+		t.Error("Deliver with wrong secret succeeded, want error")
+	}
+	if attempts != 3 {
+		t.Errorf("Deliver made %d attempts, want 3", attempts)
+	}
+
+	// Deliveries fail after MaxAttempts
+	failures := 0
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failures++
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	d.MaxAttempts = 2
+	sub := &Subscription{URL: failing.URL}
+	if err := d.Deliver(context.Background(), sub, ev); err == nil {
+		t.Error("Deliver to failing receiver succeeded, want error")
+	}
+	if failures != 2 {
+		t.Errorf("Deliver made %d attempts, want 2", failures)
+	}
+}
@@ -7,6 +7,7 @@ CREATE TABLE modules (
 	latest_version text NOT NULL,
 	versions text[],
 	deprecated text NOT NULL,
+	retractions jsonb,
 	updated timestamptz NOT NULL,
 	PRIMARY KEY (module_path)
 );
@@ -14,6 +15,9 @@ CREATE TABLE modules (
 -- Used for efficient pattern matching of module paths
 CREATE INDEX module_path_text_pattern_ops_idx ON modules (module_path text_pattern_ops);
 
+-- Used to find modules of repositories whose URL differs in case
+CREATE INDEX module_path_lower_idx ON modules (lower(module_path));
+
 -- Stores package information
 CREATE TABLE packages (
 	platform text NOT NULL,
@@ -28,7 +32,14 @@ CREATE TABLE packages (
 	score float NOT NULL,
 	imports text[],
 	source bytea,
+	links jsonb,
+	promoted jsonb,
+	warnings jsonb,
+	rendered bytea,
+	api jsonb,
+	licenses_detected boolean NOT NULL DEFAULT false,
 	error text NOT NULL,
+	created timestamptz NOT NULL DEFAULT NOW(),
 	searchtext tsvector GENERATED ALWAYS AS (
 		to_tsvector('english', "name") ||
 		to_tsvector('english', coalesce(synopsis, '')) ||
@@ -46,6 +57,59 @@ CREATE INDEX packages_import_path_idx ON packages (import_path);
 -- Used to search for packages
 CREATE INDEX packages_searchtext_idx ON packages USING GIN (searchtext);
 
+-- Used to list recently indexed modules
+CREATE INDEX packages_created_idx ON packages (created DESC);
+
+-- Stores license files found in modules
+CREATE TABLE licenses (
+	module_path text NOT NULL,
+	version text NOT NULL,
+	file_path text NOT NULL,
+	types text[],
+	contents text NOT NULL,
+	PRIMARY KEY (module_path, version, file_path),
+	FOREIGN KEY (module_path) REFERENCES modules (module_path) ON DELETE CASCADE
+);
+
+-- Stores the README files of modules
+CREATE TABLE readmes (
+	module_path text NOT NULL,
+	version text NOT NULL,
+	file_path text NOT NULL,
+	contents text NOT NULL,
+	html text,
+	PRIMARY KEY (module_path, version),
+	FOREIGN KEY (module_path) REFERENCES modules (module_path) ON DELETE CASCADE
+);
+
+-- Stores the compressed contents of Go source files
+CREATE TABLE source_files (
+	module_path text NOT NULL,
+	version text NOT NULL,
+	dir text NOT NULL,
+	name text NOT NULL,
+	contents bytea NOT NULL,
+	PRIMARY KEY (module_path, version, dir, name),
+	FOREIGN KEY (module_path) REFERENCES modules (module_path) ON DELETE CASCADE
+);
+
+-- Stores the interfaces implemented by the types of packages
+CREATE TABLE implements (
+	platform text NOT NULL,
+	import_path text NOT NULL,
+	version text NOT NULL,
+	module_path text NOT NULL,
+	type_name text NOT NULL,
+	pointer boolean NOT NULL,
+	iface_path text NOT NULL,
+	iface_name text NOT NULL,
+	PRIMARY KEY (platform, import_path, version, type_name, iface_path, iface_name),
+	FOREIGN KEY (module_path) REFERENCES modules (module_path) ON DELETE CASCADE
+);
+
+-- Used to speed up retrieval of the implementations of interfaces
+CREATE INDEX implements_iface_idx ON implements (platform, iface_path);
+
 -- Used to store project information
 CREATE TABLE projects (
 	module_path text NOT NULL,
@@ -65,4 +129,30 @@ CREATE TABLE blocklist (
 	PRIMARY KEY (import_path)
 );
 
+-- Stores failed fetches of import paths, so that they are not retried
+-- until they expire
+CREATE TABLE fetch_failures (
+	platform text NOT NULL,
+	import_path text NOT NULL,
+	version text NOT NULL,
+	reason text NOT NULL,
+	expires timestamptz NOT NULL,
+	PRIMARY KEY (platform, import_path, version)
+);
+
+CREATE INDEX fetch_failures_import_path_idx ON fetch_failures (import_path text_pattern_ops);
+CREATE INDEX fetch_failures_expires_idx ON fetch_failures (expires);
+
+-- Queues the webhook events of modules until their packages are stored, so
+-- that events are not lost if a fetch fails
+CREATE TABLE webhook_events (
+	id bigserial NOT NULL,
+	module_path text NOT NULL,
+	event jsonb NOT NULL,
+	PRIMARY KEY (id),
+	FOREIGN KEY (module_path) REFERENCES modules (module_path) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_events_module_path_idx ON webhook_events (module_path);
+
 COMMIT;
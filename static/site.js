@@ -238,6 +238,46 @@ document.onkeydown = function(e) {
 	return true
 }
 
+// run examples in the sandbox
+document.querySelectorAll(".run-example").forEach(el => {
+	el.onclick = e => {
+		e.preventDefault()
+		var output = el.closest(".card-body").querySelector(".run-output")
+		output.hidden = false
+		output.classList.remove("passed", "failed")
+		output.textContent = "Running..."
+		fetch("?run=" + encodeURIComponent(el.dataset.run), {method: "POST"})
+			.then(resp => {
+				if (!resp.ok) {
+					throw new Error(resp.statusText)
+				}
+				return resp.json()
+			})
+			.then(r => {
+				var text = r.output
+				if (r.errors) {
+					text += r.errors
+				}
+				if (r.timed_out) {
+					text += "\nTimed out."
+				} else if (r.exit_code != 0) {
+					text += "\nExit status " + r.exit_code + "."
+				}
+				if (r.passed === true) {
+					text += "\nOutput matches."
+					output.classList.add("passed")
+				} else if (r.passed === false) {
+					text += "\nOutput does not match the expected output."
+					output.classList.add("failed")
+				}
+				output.textContent = text
+			})
+			.catch(err => {
+				output.textContent = "Error running example: " + err.message
+			})
+	}
+})
+
 function onhashchange() {
 	// open selected example
 	var hash = window.location.hash
@@ -245,6 +285,15 @@ function onhashchange() {
 		var example = document.querySelector(hash)
 		example.parentElement.setAttribute("open", "")
 		example.scrollIntoView()
+		return
+	}
+	// open collapsed deprecated declarations containing the selected identifier
+	var target = hash.length > 1 ? document.getElementById(decodeURIComponent(hash.slice(1))) : null
+	if (target != null) {
+		for (var el = target.closest("details.deprecated"); el != null; el = el.parentElement.closest("details.deprecated")) {
+			el.setAttribute("open", "")
+		}
+		target.scrollIntoView()
 	}
 }
 window.addEventListener("hashchange", onhashchange)
@@ -0,0 +1,112 @@
+-- Upgrades the database of an existing installation to the current schema.
+-- Running it again has no effect.
+BEGIN;
+
+ALTER TABLE modules ADD COLUMN IF NOT EXISTS retractions jsonb;
+
+-- Used to find modules of repositories whose URL differs in case
+CREATE INDEX IF NOT EXISTS module_path_lower_idx ON modules (lower(module_path));
+
+ALTER TABLE packages
+	ADD COLUMN IF NOT EXISTS links jsonb,
+	ADD COLUMN IF NOT EXISTS promoted jsonb,
+	ADD COLUMN IF NOT EXISTS warnings jsonb,
+	ADD COLUMN IF NOT EXISTS rendered bytea,
+	ADD COLUMN IF NOT EXISTS api jsonb,
+	-- Packages fetched before license files were stored have their
+	-- licenses detected when they are next viewed
+	ADD COLUMN IF NOT EXISTS licenses_detected boolean NOT NULL DEFAULT false,
+	ADD COLUMN IF NOT EXISTS created timestamptz;
+
+-- Packages stored before the time they were indexed was recorded are
+-- dated by their commit time, so that they aren't listed as recently
+-- indexed
+UPDATE packages SET created = commit_time WHERE created IS NULL;
+ALTER TABLE packages
+	ALTER COLUMN created SET DEFAULT NOW(),
+	ALTER COLUMN created SET NOT NULL;
+
+-- Used to list recently indexed modules
+CREATE INDEX IF NOT EXISTS packages_created_idx ON packages (created DESC);
+
+-- Stores license files found in modules
+CREATE TABLE IF NOT EXISTS licenses (
+	module_path text NOT NULL,
+	version text NOT NULL,
+	file_path text NOT NULL,
+	types text[],
+	contents text NOT NULL,
+	PRIMARY KEY (module_path, version, file_path),
+	FOREIGN KEY (module_path) REFERENCES modules (module_path) ON DELETE CASCADE
+);
+
+-- Stores the README files of modules
+CREATE TABLE IF NOT EXISTS readmes (
+	module_path text NOT NULL,
+	version text NOT NULL,
+	file_path text NOT NULL,
+	contents text NOT NULL,
+	html text,
+	PRIMARY KEY (module_path, version),
+	FOREIGN KEY (module_path) REFERENCES modules (module_path) ON DELETE CASCADE
+);
+
+-- README files stored before they were rendered when modules are fetched
+-- are rendered when they are next viewed
+ALTER TABLE readmes ADD COLUMN IF NOT EXISTS html text;
+
+-- Stores the compressed contents of Go source files
+CREATE TABLE IF NOT EXISTS source_files (
+	module_path text NOT NULL,
+	version text NOT NULL,
+	dir text NOT NULL,
+	name text NOT NULL,
+	contents bytea NOT NULL,
+	PRIMARY KEY (module_path, version, dir, name),
+	FOREIGN KEY (module_path) REFERENCES modules (module_path) ON DELETE CASCADE
+);
+
+-- Stores the interfaces implemented by the types of packages
+CREATE TABLE IF NOT EXISTS implements (
+	platform text NOT NULL,
+	import_path text NOT NULL,
+	version text NOT NULL,
+	module_path text NOT NULL,
+	type_name text NOT NULL,
+	pointer boolean NOT NULL,
+	iface_path text NOT NULL,
+	iface_name text NOT NULL,
+	PRIMARY KEY (platform, import_path, version, type_name, iface_path, iface_name),
+	FOREIGN KEY (module_path) REFERENCES modules (module_path) ON DELETE CASCADE
+);
+
+-- Used to speed up retrieval of the implementations of interfaces
+CREATE INDEX IF NOT EXISTS implements_iface_idx ON implements (platform, iface_path);
+
+-- Stores failed fetches of import paths, so that they are not retried
+-- until they expire
+CREATE TABLE IF NOT EXISTS fetch_failures (
+	platform text NOT NULL,
+	import_path text NOT NULL,
+	version text NOT NULL,
+	reason text NOT NULL,
+	expires timestamptz NOT NULL,
+	PRIMARY KEY (platform, import_path, version)
+);
+
+CREATE INDEX IF NOT EXISTS fetch_failures_import_path_idx ON fetch_failures (import_path text_pattern_ops);
+CREATE INDEX IF NOT EXISTS fetch_failures_expires_idx ON fetch_failures (expires);
+
+-- Queues the webhook events of modules until their packages are stored, so
+-- that events are not lost if a fetch fails
+CREATE TABLE IF NOT EXISTS webhook_events (
+	id bigserial NOT NULL,
+	module_path text NOT NULL,
+	event jsonb NOT NULL,
+	PRIMARY KEY (id),
+	FOREIGN KEY (module_path) REFERENCES modules (module_path) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS webhook_events_module_path_idx ON webhook_events (module_path);
+
+COMMIT;